@@ -0,0 +1,352 @@
+package kleos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultDropReportInterval is how often an AsyncWriter logs the number of messages it had to
+// drop, if any.
+const DefaultDropReportInterval = time.Minute
+
+// OverflowPolicy determines what an AsyncWriter does with a new message when its buffer is
+// full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock waits for room in the buffer, blocking the caller.  No messages are
+	// dropped.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropNewest discards the new message.
+	OverflowDropNewest
+
+	// OverflowDropOldest discards the oldest message in the buffer to make room for the new
+	// one.
+	OverflowDropOldest
+
+	// OverflowDropDebug discards debug messages first:  the new message if it's a debug
+	// message, otherwise the oldest debug message in the buffer.  If there are no debug
+	// messages to drop, the new message is discarded.
+	OverflowDropDebug
+)
+
+// AsyncWriter wraps another Writer and writes messages to it from a background goroutine, so
+// a slow disk or network connection doesn't hold up the code doing the logging.  Messages wait
+// in a fixed-size buffer; what happens when the buffer fills up depends on the
+// OverflowPolicy.
+//
+// Dropped messages are counted, and the count is periodically written to the wrapped output as
+// a log message of its own.  Call Flush to wait for the buffered messages to be written, and
+// Close when shutting down so no messages are lost.
+//
+// Because messages are written later, don't modify a Fields map after logging it.
+type AsyncWriter struct {
+	out    Writer
+	policy OverflowPolicy
+
+	mutex    sync.Mutex
+	notEmpty *sync.Cond // signals the background goroutine
+	notFull  *sync.Cond // signals callers waiting on OverflowBlock
+
+	buf   []Message // ring buffer of pending messages
+	head  int       // index of the oldest message in buf
+	count int       // number of pending messages
+	busy  bool      // the background goroutine is writing a message
+	idle  chan struct{}
+
+	closed bool
+	done   chan struct{}
+
+	dropped    uint64 // messages dropped, total
+	reported   uint64 // dropped messages already reported
+	interval   time.Duration
+	lastReport time.Time
+	timer      *time.Timer
+}
+
+// NewAsyncWriter wraps the output in an AsyncWriter that buffers up to size messages.  The
+// policy determines what happens to new messages when the buffer is full.
+func NewAsyncWriter(out Writer, size int, policy OverflowPolicy) *AsyncWriter {
+	if size < 1 {
+		size = 1
+	}
+
+	w := &AsyncWriter{
+		out:        out,
+		policy:     policy,
+		buf:        make([]Message, size),
+		done:       make(chan struct{}),
+		interval:   DefaultDropReportInterval,
+		lastReport: time.Now(),
+	}
+	w.notEmpty = sync.NewCond(&w.mutex)
+	w.notFull = sync.NewCond(&w.mutex)
+
+	go w.run()
+
+	return w
+}
+
+// SetReportInterval changes how often the number of dropped messages is logged.  Zero
+// disables the periodic report, though dropped messages are still reported on Close.
+func (w *AsyncWriter) SetReportInterval(interval time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.interval = interval
+}
+
+// Dropped returns the total number of messages dropped because the buffer was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dropped
+}
+
+// Write adds the message to the buffer to be written in the background.  The message's fields
+// are resolved and copied first, so changes to the fields or the context after logging don't
+// change what's written.
+func (w *AsyncWriter) Write(m Message) error {
+	m = detach(m)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if w.count == len(w.buf) {
+		switch w.policy {
+		case OverflowDropNewest:
+			w.drop()
+			return nil
+
+		case OverflowDropOldest:
+			w.remove(0)
+			w.drop()
+
+		case OverflowDropDebug:
+			if m.Level() == DebugLevel {
+				w.drop()
+				return nil
+			}
+
+			i := w.oldestDebug()
+			if i < 0 {
+				w.drop()
+				return nil
+			}
+
+			w.remove(i)
+			w.drop()
+
+		default:
+			for w.count == len(w.buf) && !w.closed {
+				w.notFull.Wait()
+			}
+
+			if w.closed {
+				return ErrWriterClosed
+			}
+		}
+	}
+
+	w.buf[(w.head+w.count)%len(w.buf)] = m
+	w.count++
+	w.notEmpty.Signal()
+
+	return nil
+}
+
+// Resolves the message's context values, bound fields, and error fields, and copies the fields
+// passed to With and Add, so the message no longer shares them with the caller.  Redacted and
+// parsed messages already have their own copies.
+func detach(m Message) Message {
+	if m.resolved {
+		return m
+	}
+
+	m.base = m.boundFields()
+	m.errFields = m.ErrorFields()
+	m.resolved = true
+
+	if len(m.fields) > 0 {
+		fields := make(Fields, len(m.fields))
+		for k, v := range m.fields {
+			fields[k] = v
+		}
+
+		m.fields = fields
+	}
+
+	if len(m.typed) > 0 {
+		m.typed = append([]Field(nil), m.typed...)
+	}
+
+	return m
+}
+
+// Flush waits for the buffered messages to be written, or for the context to be done.  If the
+// wrapped output also buffers messages, it's flushed too.
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.mutex.Lock()
+	if w.count == 0 && !w.busy {
+		w.mutex.Unlock()
+		return w.flushOutput(ctx)
+	}
+
+	if w.idle == nil {
+		w.idle = make(chan struct{})
+	}
+	idle := w.idle
+	w.mutex.Unlock()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return w.flushOutput(ctx)
+}
+
+// Flushes the wrapped output, if it buffers messages.
+func (w *AsyncWriter) flushOutput(ctx context.Context) error {
+	if flusher, ok := w.out.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
+
+// Close stops accepting messages, then waits for the buffered messages to be written.  Any
+// messages dropped since the last report are reported before Close returns.  Doesn't close
+// the wrapped output.
+func (w *AsyncWriter) Close() error {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		w.notEmpty.Broadcast()
+		w.notFull.Broadcast()
+	}
+	w.mutex.Unlock()
+
+	<-w.done
+
+	return nil
+}
+
+// Writes the buffered messages to the wrapped output until the writer is closed.
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for {
+		for w.count == 0 && !w.closed && !w.reportDue() {
+			w.notEmpty.Wait()
+		}
+
+		var m Message
+		switch {
+		case w.count > 0:
+			m = w.buf[w.head]
+			w.remove(0)
+			w.notFull.Signal()
+		case w.reportDue() || (w.closed && w.dropped > w.reported):
+			m = w.report()
+		default:
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			return
+		}
+
+		w.busy = true
+		w.mutex.Unlock()
+
+		if err := w.out.Write(m); err != nil {
+			reportError(err)
+		}
+
+		w.mutex.Lock()
+		w.busy = false
+
+		if w.count == 0 && w.idle != nil {
+			close(w.idle)
+			w.idle = nil
+		}
+	}
+}
+
+// Removes the i'th oldest message from the buffer.  Must be called with the mutex held.
+func (w *AsyncWriter) remove(i int) {
+	size := len(w.buf)
+
+	for j := i; j > 0; j-- {
+		w.buf[(w.head+j)%size] = w.buf[(w.head+j-1)%size]
+	}
+
+	w.buf[w.head] = Message{}
+	w.head = (w.head + 1) % size
+	w.count--
+}
+
+// Returns the position of the oldest debug message in the buffer, or -1 if there are none.
+// Must be called with the mutex held.
+func (w *AsyncWriter) oldestDebug() int {
+	for i := 0; i < w.count; i++ {
+		if w.buf[(w.head+i)%len(w.buf)].Level() == DebugLevel {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Counts a dropped message, and schedules a report of the dropped messages.  Must be called
+// with the mutex held.
+func (w *AsyncWriter) drop() {
+	w.dropped++
+
+	if w.interval <= 0 || w.timer != nil {
+		return
+	}
+
+	wait := w.interval - time.Since(w.lastReport)
+	w.timer = time.AfterFunc(wait, func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		w.timer = nil
+		w.notEmpty.Broadcast()
+	})
+}
+
+// Is it time to report on dropped messages?  Must be called with the mutex held.
+func (w *AsyncWriter) reportDue() bool {
+	return w.interval > 0 && w.dropped > w.reported && time.Since(w.lastReport) >= w.interval
+}
+
+// Generates a log message reporting the number of messages dropped since the last report.
+// Must be called with the mutex held.
+func (w *AsyncWriter) report() Message {
+	dropped := w.dropped - w.reported
+
+	w.reported = w.dropped
+	w.lastReport = time.Now()
+
+	return Message{
+		when:  w.lastReport,
+		level: WarnLevel,
+		msg:   "Dropped log messages",
+		fields: Fields{
+			"dropped": dropped,
+		},
+	}
+}
@@ -0,0 +1,254 @@
+package kleos_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// An io.Writer that holds up writes until it's opened, to simulate a slow output.
+type gate struct {
+	sync.Mutex
+
+	open chan struct{}
+	buf  bytes.Buffer
+}
+
+func newGate() *gate {
+	return &gate{open: make(chan struct{})}
+}
+
+func (g *gate) Write(b []byte) (int, error) {
+	<-g.open
+
+	g.Lock()
+	defer g.Unlock()
+
+	return g.buf.Write(b)
+}
+
+func (g *gate) String() string {
+	g.Lock()
+	defer g.Unlock()
+
+	return g.buf.String()
+}
+
+// Returns the log messages written, in order.
+func (g *gate) messages() []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(g.String()), "\n") {
+		for _, msg := range []string{"first", "second", "third", "fourth", "debug", "Dropped log messages"} {
+			if strings.Contains(line, " "+msg+" ") || strings.Contains(line, " "+msg+",") {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+
+	return msgs
+}
+
+// Creates a logger writing to an AsyncWriter over the gate.  The first message is written
+// and held at the gate, so the buffer is empty to start.
+func asyncLogger(t *testing.T, size int, policy kleos.OverflowPolicy) (*kleos.Kleos, *kleos.AsyncWriter, *gate) {
+	g := newGate()
+	w := kleos.NewAsyncWriter(kleos.NewTextOutput(g), size, policy)
+
+	log := kleos.New()
+	log.SetOutput(w)
+	log.SetVerbosity(1)
+
+	log.Log("first")
+
+	// Wait for the background goroutine to pick up the first message
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 100; i++ {
+		if w.Flush(ctx) != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return log, w, g
+}
+
+func TestAsyncWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	w := kleos.NewAsyncWriter(kleos.NewTextOutput(&out), 10, kleos.OverflowBlock)
+
+	log := kleos.New()
+	log.SetOutput(w)
+
+	for i := 0; i < 100; i++ {
+		log.With(kleos.Fields{"n": i}).Log("Hello World")
+	}
+
+	assert.NoError(w.Flush(context.Background()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 100)
+	for i, line := range lines {
+		assert.Contains(line, fmt.Sprintf("n=%d", i))
+	}
+
+	assert.NoError(w.Close())
+	assert.ErrorIs(w.Write(kleos.Message{}), kleos.ErrWriterClosed)
+}
+
+func TestAsyncResolvesFields(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 10, kleos.OverflowBlock)
+
+	type key struct{}
+	log.Register(func(ctx context.Context, fields kleos.Fields) {
+		if v, ok := ctx.Value(key{}).(*string); ok {
+			fields["request"] = *v
+		}
+	})
+
+	request := "abc"
+	fields := kleos.Fields{"user": "alice"}
+	typed := []kleos.Field{kleos.String("role", "admin")}
+
+	log.Context(context.WithValue(context.Background(), key{}, &request)).
+		With(fields).
+		Add(typed...).
+		Log("second")
+
+	// Changes after logging shouldn't reach the queued message
+	request = "xyz"
+	fields["user"] = "bob"
+	typed[0] = kleos.String("role", "guest")
+
+	close(g.open)
+	assert.NoError(w.Flush(context.Background()))
+
+	out := g.String()
+	assert.Contains(out, "request=abc")
+	assert.Contains(out, "user=alice")
+	assert.Contains(out, "role=admin")
+}
+
+func TestAsyncDropNewest(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 1, kleos.OverflowDropNewest)
+	w.SetReportInterval(0)
+
+	log.Log("second")
+	log.Log("third")
+	log.Log("fourth")
+
+	assert.Equal(uint64(2), w.Dropped())
+
+	close(g.open)
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{"first", "second", "Dropped log messages"}, g.messages())
+	assert.Contains(g.String(), "dropped=2")
+}
+
+func TestAsyncDropOldest(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 1, kleos.OverflowDropOldest)
+	w.SetReportInterval(0)
+
+	log.Log("second")
+	log.Log("third")
+	log.Log("fourth")
+
+	assert.Equal(uint64(2), w.Dropped())
+
+	close(g.open)
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{"first", "fourth", "Dropped log messages"}, g.messages())
+}
+
+func TestAsyncDropDebug(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 2, kleos.OverflowDropDebug)
+	w.SetReportInterval(0)
+
+	log.V(1).Log("debug")
+	log.Log("second")
+	log.Log("third")      // drops the buffered debug message
+	log.V(1).Log("debug") // dropped
+	log.Log("fourth")     // dropped; nothing left to make room for it
+
+	assert.Equal(uint64(3), w.Dropped())
+
+	close(g.open)
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{"first", "second", "third", "Dropped log messages"}, g.messages())
+}
+
+func TestAsyncBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 1, kleos.OverflowBlock)
+
+	log.Log("second")
+
+	done := make(chan struct{})
+	go func() {
+		log.Log("third")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the log message to block")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(w.Flush(ctx), context.DeadlineExceeded)
+
+	close(g.open)
+	<-done
+
+	assert.NoError(w.Flush(context.Background()))
+	assert.Equal([]string{"first", "second", "third"}, g.messages())
+	assert.Equal(uint64(0), w.Dropped())
+}
+
+func TestAsyncReport(t *testing.T) {
+	assert := assert.New(t)
+
+	log, w, g := asyncLogger(t, 1, kleos.OverflowDropNewest)
+	w.SetReportInterval(20 * time.Millisecond)
+
+	log.Log("second")
+	log.Log("third")
+
+	close(g.open)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(g.String(), "Dropped log messages") {
+		if time.Now().After(deadline) {
+			t.Fatal("dropped messages were never reported")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Contains(g.String(), "dropped=1")
+	assert.NoError(w.Close())
+	assert.Equal([]string{"first", "second", "Dropped log messages"}, g.messages())
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sbowman/kleos"
+)
+
+// Copies the messages from the inputs to the output.
+type copier struct {
+	sync.Mutex // messages from different files mustn't interleave
+
+	schema kleos.JSONSchema // the keys in the JSON messages
+	out    kleos.Writer     // where to write the messages
+	raw    io.Writer        // where to write lines that aren't messages; nil to drop them
+}
+
+// Creates a reader for the input.
+func (c *copier) reader(in io.Reader) *kleos.MessageReader {
+	reader := kleos.NewMessageReader(in)
+	reader.JSONSchema = c.schema
+
+	return reader
+}
+
+// Copies the messages until the end of the input.
+func (c *copier) copy(reader *kleos.MessageReader) error {
+	for {
+		m, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var parseErr *kleos.ParseError
+		if errors.As(err, &parseErr) {
+			if err := c.passthrough(parseErr.Line); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := c.write(m); err != nil {
+			return err
+		}
+	}
+}
+
+// Writes the message to the output.
+func (c *copier) write(m kleos.Message) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.out.Write(m)
+}
+
+// Writes a line that isn't a message, if the output accepts them.
+func (c *copier) passthrough(line string) error {
+	if c.raw == nil {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	_, err := fmt.Fprintln(c.raw, line)
+	return err
+}
+
+// Copies the messages in the file.
+func (c *copier) copyFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	return c.copy(c.reader(f))
+}
+
+// Copies the messages in the file, then waits for more to be written, until the context is
+// done.  Starts over if the file is truncated, and switches to the new file if it's rotated.
+func (c *copier) follow(ctx context.Context, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := c.reader(f)
+	reader.Follow = true
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.copy(reader); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Moved away, but the new file hasn't been created yet
+		latest, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if !os.SameFile(latest, current) {
+			// Catch anything written before the file was rotated
+			if err := c.copy(reader); err != nil {
+				return err
+			}
+
+			rotated, err := os.Open(name)
+			if err != nil {
+				continue
+			}
+
+			_ = f.Close()
+			f = rotated
+
+			reader = c.reader(f)
+			reader.Follow = true
+
+			continue
+		}
+
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if latest.Size() < offset {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			reader = c.reader(f)
+			reader.Follow = true
+		}
+	}
+}
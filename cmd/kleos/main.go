@@ -0,0 +1,298 @@
+// Command kleos reads the log messages written by the kleos JSON and text outputs and writes them
+// to another kleos output, e.g. to read production JSON logs as color text:
+//
+//	kleos -level warn -where 'status>=500' app.log
+//	kubectl logs -f api | kleos -since 1h
+//	kleos -f -output text -pkg billing,payments /var/log/app/*.log
+//
+// With no files, or a file named "-", the messages are read from stdin.  Lines that aren't log
+// messages, such as a panic, are passed through to the text outputs unchanged, and dropped by
+// the JSON outputs.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sbowman/kleos"
+)
+
+// How often to check a followed file for new messages.
+const pollInterval = 250 * time.Millisecond
+
+// The JSON schemas, by name.
+var schemas = map[string]kleos.JSONSchema{
+	"default":  kleos.DefaultJSONSchema,
+	"logstash": kleos.LogstashJSONSchema,
+	"datadog":  kleos.DatadogJSONSchema,
+	"gcp":      kleos.GCPJSONSchema,
+	"loki":     kleos.LokiJSONSchema,
+}
+
+// Repeatable flag for the field expressions.
+type expressions []string
+
+func (e *expressions) String() string {
+	return strings.Join(*e, ", ")
+}
+
+func (e *expressions) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
+
+// The command line options.
+type options struct {
+	output    string
+	schema    string
+	service   string
+	flatten   bool
+	maxLength int
+	level     string
+	verbosity int
+	pkgs      string
+	since     string
+	until     string
+	where     expressions
+	follow    bool
+	files     []string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Runs the command, returning the exit status.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	schema, ok := schemas[opts.schema]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "unknown schema %q\n", opts.schema)
+		return 2
+	}
+
+	out, passthrough, err := newOutput(opts, stdout)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	filters, err := newFilters(opts, time.Now())
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	c := &copier{
+		schema: schema,
+		out:    kleos.NewMultiWriter().Add(out, filters...),
+	}
+
+	if passthrough {
+		c.raw = stdout
+	}
+
+	if len(opts.files) == 0 {
+		opts.files = []string{"-"}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	status := 0
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		_, _ = fmt.Fprintln(stderr, err)
+		status = 1
+	}
+
+	for _, name := range opts.files {
+		switch {
+		case name == "-":
+			if err := c.copy(c.reader(stdin)); err != nil {
+				fail(err)
+			}
+		case opts.follow:
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+
+				if err := c.follow(ctx, name); err != nil {
+					fail(err)
+				}
+			}(name)
+		default:
+			if err := c.copyFile(name); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	wg.Wait()
+
+	return status
+}
+
+// Parses the command line.
+func parseFlags(args []string, stderr io.Writer) (options, error) {
+	var opts options
+
+	fs := flag.NewFlagSet("kleos", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: kleos [flags] [file ...]")
+		_, _ = fmt.Fprintln(stderr)
+		_, _ = fmt.Fprintln(stderr, "Reads the messages written by the kleos JSON and text outputs from the files, or")
+		_, _ = fmt.Fprintln(stderr, "stdin, and writes them to another output.")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.output, "output", "color", "write `format`: color, text, json, logstash, datadog, gcp, loki, or ecs")
+	fs.StringVar(&opts.schema, "schema", "default", "read JSON with the keys of the `schema`: default, logstash (or ECS), datadog, gcp, or loki")
+	fs.StringVar(&opts.service, "service", "", "the service `name` for the ecs output")
+	fs.BoolVar(&opts.flatten, "flatten", false, "write nested fields as dotted keys in the text outputs, e.g. user.id=5")
+	fs.IntVar(&opts.maxLength, "max-length", 0, "truncate field values longer than `n` characters in the text outputs")
+	fs.StringVar(&opts.level, "level", "debug", "only messages at or above the `level`: debug, info, warn, error, or fatal")
+	fs.IntVar(&opts.verbosity, "v", -1, "only debug messages up to the `verbosity`; -1 for all")
+	fs.StringVar(&opts.pkgs, "pkg", "", "only messages logged from the comma-separated `packages`")
+	fs.StringVar(&opts.since, "since", "", "only messages logged at or after the `time`, e.g. 2024-03-09T17:00:00Z or 1h for an hour ago")
+	fs.StringVar(&opts.until, "until", "", "only messages logged before the `time`")
+	fs.Var(&opts.where, "where", "only messages with fields matching the `expression`, e.g. status>=500; may be repeated")
+	fs.BoolVar(&opts.follow, "f", false, "follow the files, writing messages as they're logged")
+	fs.BoolVar(&opts.follow, "follow", false, "same as -f")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	opts.files = fs.Args()
+
+	return opts, nil
+}
+
+// Creates the output.  Returns true if lines that aren't log messages should be passed
+// through, as they are for the text outputs.
+func newOutput(opts options, stdout io.Writer) (kleos.Writer, bool, error) {
+	format := kleos.TextFormat{MaxLength: opts.maxLength}
+	if opts.flatten {
+		format.Nested = kleos.NestedFlatten
+	}
+
+	switch opts.output {
+	case "color":
+		out := kleos.NewColorOutput(stdout)
+		out.TextFormat = format
+		return out, true, nil
+	case "text":
+		out := kleos.NewTextOutput(stdout)
+		out.TextFormat = format
+		return out, true, nil
+	case "ecs":
+		return kleos.NewECSOutput(opts.service, stdout), false, nil
+	case "json":
+		return kleos.NewJSONOutput(stdout), false, nil
+	}
+
+	schema, ok := schemas[opts.output]
+	if !ok || opts.output == "default" {
+		return nil, false, fmt.Errorf("unknown output %q", opts.output)
+	}
+
+	out := kleos.NewJSONOutput(stdout)
+	out.JSONSchema = schema
+
+	return out, false, nil
+}
+
+// Creates the filters for the level, verbosity, packages, time range, and field expressions.
+func newFilters(opts options, now time.Time) ([]kleos.Filter, error) {
+	var filters []kleos.Filter
+
+	level, err := kleos.ParseLevel(opts.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if level > kleos.DebugLevel {
+		filters = append(filters, kleos.MinLevel(level))
+	}
+
+	if opts.verbosity >= 0 {
+		if opts.verbosity > 255 {
+			return nil, fmt.Errorf("invalid verbosity %d", opts.verbosity)
+		}
+
+		filters = append(filters, kleos.MaxVerbosity(uint8(opts.verbosity)))
+	}
+
+	if opts.pkgs != "" {
+		filters = append(filters, kleos.Packages(strings.Split(opts.pkgs, ",")...))
+	}
+
+	since, err := parseTime(opts.since, now)
+	if err != nil {
+		return nil, err
+	}
+
+	until, err := parseTime(opts.until, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if !since.IsZero() || !until.IsZero() {
+		filters = append(filters, kleos.TimeRange(since, until))
+	}
+
+	for _, expr := range opts.where {
+		filter, err := where(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// Parses a time given on the command line:  a timestamp, a date, or a duration before now.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q; expected a timestamp, e.g. 2024-03-09T17:00:00Z, a date, or a duration, e.g. 1h", value)
+}
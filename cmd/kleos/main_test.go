@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonLogs = `{"level":"info","msg":"Started","pkg":"main","src":"main.go","line":12,"ts":"2024-03-09T17:00:00.000Z"}
+{"level":"debug","msg":"Connecting","pkg":"db","src":"db.go","line":40,"ts":"2024-03-09T17:00:01.000Z","v":2}
+{"level":"debug","msg":"Connected","pkg":"db","src":"db.go","line":52,"ts":"2024-03-09T17:00:01.500Z","v":4}
+{"err":"card declined","err_type":"*billing.Error","level":"error","msg":"Unable to charge","pkg":"billing","src":"charge.go","line":88,"status":402,"ts":"2024-03-09T18:00:00.000Z","user":{"id":5}}
+panic: oops
+{"level":"warn","msg":"Slow request","pkg":"api","src":"api.go","line":20,"status":200,"took":"1.5s","ts":"2024-03-09T19:00:00.000Z"}
+`
+
+// Runs the command against the logs, returning what it wrote to stdout and stderr.
+func runCommand(t *testing.T, logs string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+
+	status := run(context.Background(), args, strings.NewReader(logs), &stdout, &stderr)
+
+	return stdout.String(), stderr.String(), status
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		comment string
+		args    []string
+		want    []string
+	}{
+		{"all", []string{"-output", "text"}, []string{"Started", "Connecting", "Connected", "Unable to charge", "panic: oops", "Slow request"}},
+		{"level", []string{"-output", "text", "-level", "warn"}, []string{"Unable to charge", "panic: oops", "Slow request"}},
+		{"verbosity", []string{"-output", "text", "-v", "2"}, []string{"Started", "Connecting", "Unable to charge", "panic: oops", "Slow request"}},
+		{"packages", []string{"-output", "text", "-pkg", "db,api"}, []string{"Connecting", "Connected", "panic: oops", "Slow request"}},
+		{"since", []string{"-output", "text", "-since", "2024-03-09T18:00:00Z"}, []string{"Unable to charge", "panic: oops", "Slow request"}},
+		{"until", []string{"-output", "text", "-until", "2024-03-09T17:00:01Z"}, []string{"Started", "panic: oops"}},
+		{"where", []string{"-output", "text", "-where", "status>=400"}, []string{"Unable to charge", "panic: oops"}},
+		{"where nested", []string{"-output", "text", "-where", "user.id=5"}, []string{"Unable to charge", "panic: oops"}},
+		{"where repeated", []string{"-output", "text", "-where", "status", "-where", "took<2s"}, []string{"Slow request", "panic: oops"}},
+		{"json drops invalid lines", []string{"-output", "json", "-level", "error"}, []string{`"msg":"Unable to charge"`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			stdout, stderr, status := runCommand(t, jsonLogs, test.args...)
+
+			assert.Equal(t, 0, status, stderr)
+			assert.Equal(t, len(test.want), strings.Count(stdout, "\n"), stdout)
+
+			for _, want := range test.want {
+				assert.Contains(t, stdout, want)
+			}
+		})
+	}
+}
+
+func TestRunOutputs(t *testing.T) {
+	assert := assert.New(t)
+
+	stdout, _, _ := runCommand(t, jsonLogs, "-output", "text", "-level", "error", "-flatten")
+	assert.Equal(`2024-03-09T18:00:00.000Z ERR Unable to charge (billing/charge.go:88), err="card declined", status=402, user.id=5`+"\npanic: oops\n", stdout)
+
+	stdout, _, _ = runCommand(t, jsonLogs, "-output", "gcp", "-level", "error")
+	assert.Contains(stdout, `"severity":"ERROR"`)
+	assert.Contains(stdout, `"error_type":"*billing.Error"`)
+
+	// Back again
+	text, _, _ := runCommand(t, stdout, "-output", "text", "-schema", "gcp")
+	assert.Contains(text, `ERR Unable to charge (billing/charge.go:88), err="card declined"`)
+
+	stdout, _, _ = runCommand(t, jsonLogs, "-output", "ecs", "-service", "api", "-level", "error")
+	assert.Contains(stdout, `"service":{"name":"api"}`)
+}
+
+func TestRunInvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-output", "xml"},
+		{"-schema", "xml"},
+		{"-level", "verbose"},
+		{"-since", "yesterday"},
+		{"-where", "=5"},
+		{"-where", "path~["},
+		{"-v", "300"},
+		{"-nope"},
+	} {
+		_, stderr, status := runCommand(t, "", args...)
+		assert.Equal(t, 2, status, args)
+		assert.NotEmpty(t, stderr, args)
+	}
+
+	_, stderr, status := runCommand(t, "", "missing.log")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "missing.log")
+}
+
+func TestWhere(t *testing.T) {
+	m, err := kleos.ParseMessage([]byte(`{"ts":"2024-03-09T17:00:00Z","msg":"Hello","status":404,"path":"/api/users","took":"250ms","user":{"id":5,"name":"Bob"},"user.role":"admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"status=404", true},
+		{"status=404.0", true},
+		{"status!=404", false},
+		{"status>400", true},
+		{"status>=404", true},
+		{"status<404", false},
+		{"status<=404", true},
+		{"path=/api/users", true},
+		{"path~^/api/", true},
+		{"path!~^/api/", false},
+		{"took<1s", true},
+		{"took>100ms", true},
+		{"user.id=5", true},
+		{"user.name=Bob", true},
+		{"user.role=admin", true},
+		{"status", true},
+		{"!status", false},
+		{"missing", false},
+		{"!missing", true},
+		{"missing=5", false},
+		{"missing!=5", true},
+		{"missing!~x", true},
+		{" status = 404 ", true},
+	}
+
+	for _, test := range tests {
+		filter, err := where(test.expr)
+		if assert.NoError(t, err, test.expr) {
+			assert.Equal(t, test.want, filter(m), test.expr)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	assert := assert.New(t)
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(name, []byte("2024-03-09T17:00:00.000Z INF one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out syncBuffer
+
+	c := &copier{
+		schema: kleos.DefaultJSONSchema,
+		out:    kleos.NewTextOutput(&out),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- c.follow(ctx, name)
+	}()
+
+	waitFor := func(want string) {
+		assert.Eventually(func() bool { return strings.Contains(out.String(), want) }, 5*time.Second, 10*time.Millisecond, want)
+	}
+
+	waitFor(" INF one\n")
+
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = f.WriteString("2024-03-09T17:00:01.000Z INF t")
+	_, _ = f.WriteString("wo\n")
+	_ = f.Close()
+
+	waitFor(" INF two\n")
+
+	// Truncated, e.g. by logrotate's copytruncate
+	if err := os.WriteFile(name, []byte("2024-03-09T17:00:02.000Z INF 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(" INF 3\n")
+
+	// Rotated
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(name, []byte("2024-03-09T17:00:03.000Z INF rotated\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(" INF rotated\n")
+
+	cancel()
+	assert.NoError(<-done)
+
+	assert.Equal(4, strings.Count(out.String(), "\n"), out.String())
+}
+
+// A buffer that's safe to read while the follower writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sbowman/kleos"
+)
+
+// The comparison operators, longest first so "!=" isn't mistaken for "=".
+var operators = []string{"!=", ">=", "<=", "!~", "=", ">", "<", "~"}
+
+// Parses a field expression into a filter:
+//
+//	status=500     the field equals the value
+//	status!=500    the field is missing or doesn't equal the value
+//	status>=500    the field is greater than or equal to the value; also >, <, and <=
+//	path~^/api/    the field matches the regular expression
+//	path!~^/api/   the field is missing or doesn't match the regular expression
+//	user           the field is present
+//	!user          the field is missing
+//
+// Numbers and durations compare by value, e.g. "took>1.5s", and anything else compares as text.
+// Dotted keys, e.g. "user.id", look in nested fields if there isn't a field with that name.
+func where(expr string) (kleos.Filter, error) {
+	key, op, value := splitExpression(expr)
+
+	if key == "" {
+		return nil, fmt.Errorf("invalid field expression %q", expr)
+	}
+
+	switch op {
+	case "":
+		if name, missing := strings.CutPrefix(key, "!"); missing {
+			return func(m kleos.Message) bool {
+				_, ok := lookup(m.Fields(), name)
+				return !ok
+			}, nil
+		}
+
+		return func(m kleos.Message) bool {
+			_, ok := lookup(m.Fields(), key)
+			return ok
+		}, nil
+	case "~", "!~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field expression %q: %w", expr, err)
+		}
+
+		negate := op == "!~"
+
+		return func(m kleos.Message) bool {
+			field, ok := lookup(m.Fields(), key)
+			if !ok {
+				return negate
+			}
+
+			return re.MatchString(fmt.Sprint(field)) != negate
+		}, nil
+	}
+
+	return func(m kleos.Message) bool {
+		field, ok := lookup(m.Fields(), key)
+		if !ok {
+			return op == "!="
+		}
+
+		cmp := compare(field, value)
+
+		switch op {
+		case "=":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	}, nil
+}
+
+// Splits the expression at the first operator, e.g. "status>=500" into "status", ">=", and
+// "500".  Returns the whole expression as the key if there's no operator.
+func splitExpression(expr string) (string, string, string) {
+	for i := range expr {
+		for _, op := range operators {
+			if strings.HasPrefix(expr[i:], op) && (op != "!=" && op != "!~" || i > 0) {
+				return strings.TrimSpace(expr[:i]), op, strings.TrimSpace(expr[i+len(op):])
+			}
+		}
+	}
+
+	return strings.TrimSpace(expr), "", ""
+}
+
+// Looks up the field by its key.  A dotted key, e.g. "user.id", may also refer to a nested
+// field.
+func lookup(fields kleos.Fields, key string) (interface{}, bool) {
+	if value, ok := fields[key]; ok {
+		return value, true
+	}
+
+	parent, child, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, false
+	}
+
+	nested, ok := fields[parent].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	return lookup(nested, child)
+}
+
+// Compares the field to the value from the expression, returning -1 if it's less, 0 if it's
+// equal, and 1 if it's greater.  Compares numbers and durations by value.
+func compare(field interface{}, value string) int {
+	if a, ok := number(field); ok {
+		if b, err := strconv.ParseFloat(value, 64); err == nil {
+			return compareFloats(a, b)
+		}
+	}
+
+	if b, err := time.ParseDuration(value); err == nil {
+		switch a := field.(type) {
+		case time.Duration:
+			return compareFloats(float64(a), float64(b))
+		case string:
+			if a, err := time.ParseDuration(a); err == nil {
+				return compareFloats(float64(a), float64(b))
+			}
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(field), value)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Returns the numeric value of the field, if it's a number.
+func number(field interface{}) (float64, bool) {
+	switch v := field.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
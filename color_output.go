@@ -3,7 +3,6 @@ package kleos
 import (
 	"fmt"
 	"io"
-	"sort"
 	"strings"
 	"sync"
 
@@ -13,9 +12,10 @@ import (
 // ColorOutput is meant to output to stdout or stderr with color.
 type ColorOutput struct {
 	sync.Mutex
+	TextFormat
 	out io.Writer
 
-	timestamp, info, err, debug, message, field, location *color.Color
+	timestamp, info, warn, err, fatal, debug, message, field, location *color.Color
 }
 
 // NewColorOutput creates a color output writer meant for stdout or stderr.
@@ -24,7 +24,9 @@ func NewColorOutput(out io.Writer) *ColorOutput {
 		out:       out,
 		timestamp: color.New(color.FgCyan, color.Faint),
 		info:      color.New(color.FgGreen),
+		warn:      color.New(color.FgYellow),
 		err:       color.New(color.FgRed),
+		fatal:     color.New(color.FgHiRed, color.Bold),
 		debug:     color.New(color.FgMagenta),
 		message:   color.New(color.FgHiWhite),
 		field:     color.New(color.FgWhite, color.Faint),
@@ -39,16 +41,21 @@ func (w *ColorOutput) Write(m Message) error {
 
 	_, _ = w.timestamp.Fprint(w.out, m.when.UTC().Format(PaddedRFC3339Ms))
 
-	if m.verbosity > 0 {
+	switch m.Level() {
+	case DebugLevel:
 		_, _ = w.debug.Fprintf(w.out, " D%02d", m.verbosity)
-	} else if m.error == nil {
-		_, _ = w.info.Fprint(w.out, " INF")
-	} else {
+	case WarnLevel:
+		_, _ = w.warn.Fprint(w.out, " WRN")
+	case ErrorLevel:
 		_, _ = w.err.Fprint(w.out, " ERR")
+	case FatalLevel:
+		_, _ = w.fatal.Fprint(w.out, " FTL")
+	default:
+		_, _ = w.info.Fprint(w.out, " INF")
 	}
 
 	// Write out the human-readable message
-	msg := strings.TrimSpace(m.msg)
+	msg := sanitizeText(strings.TrimSpace(m.msg))
 	if msg != "" {
 		_, _ = fmt.Fprint(w.out, " ")
 		_, _ = w.message.Fprint(w.out, msg)
@@ -61,37 +68,22 @@ func (w *ColorOutput) Write(m Message) error {
 
 	if m.error != nil {
 		_, _ = w.field.Fprint(w.out, ", err=")
-		_, _ = w.field.Fprint(w.out, encode(m.error.Error()))
+		_, _ = w.field.Fprint(w.out, w.encode(m.error.Error()))
 	}
 
-	if m.fields == nil {
-		m.fields = make(Fields)
+	for _, field := range w.fields(m) {
+		_, _ = w.field.Fprint(w.out, ", ")
+		_, _ = w.field.Fprint(w.out, field.key)
+		_, _ = w.field.Fprint(w.out, "=")
+		_, _ = w.field.Fprint(w.out, field.value)
 	}
 
-	// Applies any registered context variables to the fields
-	contexts.Run(m.ctx, m.fields)
-
-	if len(m.fields) > 0 {
-		// Write the fields in alphabetical order
-		var fields []string
-		for field := range m.fields {
-			fields = append(fields, field)
-		}
-		sort.Strings(fields)
-
-		for _, k := range fields {
-			v := encode(m.fields[k])
+	_, _ = fmt.Fprintln(w.out)
 
-			if v != "" {
-				_, _ = w.field.Fprint(w.out, ", ")
-				_, _ = w.field.Fprint(w.out, k)
-				_, _ = w.field.Fprint(w.out, "=")
-				_, _ = w.field.Fprint(w.out, v)
-			}
-		}
+	// Stack traces are indented beneath the message
+	for _, frame := range m.stack {
+		_, _ = w.field.Fprintf(w.out, "\t%s\n\t\t%s:%d\n", frame.Func, frame.File, frame.Line)
 	}
 
-	_, _ = fmt.Fprintln(w.out)
-
 	return nil
 }
@@ -2,6 +2,9 @@ package kleos
 
 import (
 	"fmt"
+	"log"
+	"runtime"
+	"strings"
 )
 
 // Logger represents a simple logger interface commonly used by third-party packages.
@@ -9,13 +12,63 @@ type Logger interface {
 	Printf(msg string, args ...interface{})
 }
 
-type logger struct {
-	verbosity int
+// Adapter logs messages from third-party packages that expect a simple Printf-style logger or
+// an io.Writer, such as the standard library's log.Logger.  Messages are logged at the
+// adapter's verbosity, so they're only output when the Kleos verbosity is high enough.  A
+// verbosity of zero logs info messages.
+//
+// To add fields to every message, create the adapter from a logger with bound fields:
+//
+//	pool.SetLogger(kleos.Named("pgx").Logger(3))
+type Adapter struct {
+	k         *Kleos
+	verbosity uint8
 }
 
-// Printf logs a message to Kleos logger.
-func (l logger) Printf(msg string, args ...interface{}) {
-	m := generate(local.output, local.includeSource).Source(0)
+// NewLogger creates a new logger to use with simple logging interfaces.  Logs to the global
+// logger at the given verbosity.
+func NewLogger(verbosity int) *Adapter {
+	return local.Logger(verbosity)
+}
+
+// Logger creates a new logger to use with simple logging interfaces.  Logs to this logger at
+// the given verbosity.
+func (k *Kleos) Logger(verbosity int) *Adapter {
+	if verbosity < 0 {
+		verbosity = 0
+	} else if verbosity > 255 {
+		verbosity = 255
+	}
+
+	return &Adapter{
+		k:         k,
+		verbosity: uint8(verbosity),
+	}
+}
+
+// StdLogger creates a standard library log.Logger that logs to the global logger at the given
+// verbosity.
+func StdLogger(verbosity int) *log.Logger {
+	return local.Logger(verbosity).StdLogger()
+}
+
+// StdLogger creates a standard library log.Logger that logs to this logger at the given
+// verbosity.
+func (k *Kleos) StdLogger(verbosity int) *log.Logger {
+	return k.Logger(verbosity).StdLogger()
+}
+
+// StdLogger creates a standard library log.Logger that logs through this adapter.
+func (a *Adapter) StdLogger() *log.Logger {
+	return log.New(a, "", 0)
+}
+
+// Printf logs a message to Kleos logger.  The message is formatted with fmt.Sprintf.
+func (a *Adapter) Printf(msg string, args ...interface{}) {
+	m := generate(a.k, a.verbosity)
+	if !m.Enabled() {
+		return
+	}
 
 	if len(args) == 0 {
 		m.Log(msg)
@@ -25,8 +78,51 @@ func (l logger) Printf(msg string, args ...interface{}) {
 	m.Log(fmt.Sprintf(msg, args...))
 }
 
-// NewLogger creates a new logger to use with simple logging interfaces.  Logs to the debug
-// verbosity.
-func NewLogger(verbosity int) Logger {
-	return logger{verbosity: verbosity}
+// Print logs a message to the Kleos logger.  The message is formatted with fmt.Sprint.
+func (a *Adapter) Print(args ...interface{}) {
+	if m := generate(a.k, a.verbosity); m.Enabled() {
+		m.Log(fmt.Sprint(args...))
+	}
+}
+
+// Println logs a message to the Kleos logger.  The message is formatted with fmt.Sprintln.
+func (a *Adapter) Println(args ...interface{}) {
+	if m := generate(a.k, a.verbosity); m.Enabled() {
+		m.Log(fmt.Sprintln(args...))
+	}
+}
+
+// Write logs the bytes as a message to the Kleos logger, so the adapter may be used as the
+// output of a log.Logger, e.g. with log.SetOutput.  Each call to Write is logged as a single
+// message.  The source reported, and the call checked against the verbosity overrides, is the
+// code that called the log.Logger.
+func (a *Adapter) Write(b []byte) (int, error) {
+	var pc [maxCallers]uintptr
+	skip := stdLogFrames(pc[:callers(pc[:])])
+
+	if m := generateAt(a.k, a.verbosity, skip); m.Enabled() {
+		m.Log(strings.TrimRight(string(b), "\r\n"))
+	}
+
+	return len(b), nil
+}
+
+// Counts the call stack frames belonging to the standard library's log package, to skip over
+// them when reporting the source of the message.
+func stdLogFrames(pc []uintptr) int {
+	for i := range pc {
+		frames := runtime.CallersFrames(pc[i : i+1])
+
+		// Check the outermost function, in case something was inlined into it
+		var frame runtime.Frame
+		for more := true; more; {
+			frame, more = frames.Next()
+		}
+
+		if !strings.HasPrefix(frame.Function, "log.") {
+			return i
+		}
+	}
+
+	return 0
 }
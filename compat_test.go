@@ -0,0 +1,54 @@
+package kleos_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerVerbosity(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+	k.SetVerbosity(1)
+
+	info := k.Logger(0)
+	debug := k.Logger(2)
+
+	info.Printf("Connected to %s", "db")
+	assert.Contains(out.String(), " INF Connected to db ")
+	out.Reset()
+
+	debug.Printf("Executing %s", "SELECT 1")
+	assert.Empty(out.String())
+
+	k.SetVerbosity(2)
+	debug.Printf("Executing %s", "SELECT 1")
+	assert.Contains(out.String(), " D02 Executing SELECT 1 ")
+	out.Reset()
+
+	debug.Print("Rows: ", 5)
+	assert.Contains(out.String(), " D02 Rows: 5 ")
+	out.Reset()
+
+	debug.Println("Done")
+	assert.Contains(out.String(), " D02 Done ")
+}
+
+func TestLoggerFields(t *testing.T) {
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+
+	var logger kleos.Logger = k.Named("pgx").Bind(kleos.Fields{"pool": "primary"}).Logger(0)
+	logger.Printf("Connected")
+
+	assert.Contains(t, out.String(), "logger=pgx")
+	assert.Contains(t, out.String(), "pool=primary")
+}
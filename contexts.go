@@ -5,9 +5,6 @@ import (
 	"sync"
 )
 
-// Stores context variable registrations.  See Register for more info.
-var contexts contextFuncs
-
 // ContextFunc can be registered to pull values from the context and add them to the supplied log
 // message fields.  Won't be called if ctx is nil, and fields will not be nil either.
 type ContextFunc func(ctx context.Context, fields Fields)
@@ -16,7 +13,7 @@ type ContextFunc func(ctx context.Context, fields Fields)
 // The context function should pull the desired variable out of a given context and add it to the
 // Fields map.  For example:
 //
-// 	kleos.Register(func(ctx context.Context, fields kleos.Fields) {
+//	kleos.Register(func(ctx context.Context, fields kleos.Fields) {
 //		requestID, ok := ctx.Value(CtxRequestID).(uint64)
 //		if !ok {
 //			return
@@ -25,14 +22,22 @@ type ContextFunc func(ctx context.Context, fields Fields)
 //		fields["request"] = requestID
 //	})
 //
-// The field will then be output with the rest of the fields.
+// The field will then be output with the rest of the fields.  Registers the function with the
+// global logger only.
 func Register(fn ContextFunc) {
-	contexts.Add(fn)
+	local.Register(fn)
+}
+
+// Register a context function to pull variables from the context during logging.  See the
+// package-level Register for more info.  Context functions are registered per Kleos instance,
+// so registering a function here won't affect the global logger or any other instance.
+func (k *Kleos) Register(fn ContextFunc) {
+	k.base().contexts.Add(fn)
 }
 
 // Provides some synchronous update protections around registering and using the context functions.
 type contextFuncs struct {
-	fns []ContextFunc
+	fns   []ContextFunc
 	mutex sync.RWMutex
 }
 
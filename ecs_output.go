@@ -1,91 +1,302 @@
 package kleos
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ECSVersion is the version of the Elastic Common Schema the ECSOutput conforms to.
+const ECSVersion = "8.11.0"
+
+// ECS field names for critical log data
+const (
+	ECSTimestamp  = "@timestamp"
+	ECSMessage    = "message"
+	ECSLevel      = "log.level"
+	ECSLogger     = "log.logger"
+	ECSFile       = "log.origin.file.name"
+	ECSLine       = "log.origin.file.line"
+	ECSError      = "error.message"
+	ECSErrorType  = "error.type"
+	ECSErrorCode  = "error.code"
+	ECSStackTrace = "error.stack_trace"
+	ECSHost       = "host.name"
+	ECSService    = "service.name"
+	ECSVersionKey = "ecs.version"
+	ECSVerbosity  = "kleos.verbosity"
+)
+
+// The ECS fields the ECSOutput writes.  Message fields with the same names, or whose names
+// would turn one of these into an object or replace the object holding one of these, are
+// renamed; see ecsName.
+var ecsReserved = []string{
+	ECSTimestamp, ECSMessage, ECSLevel, ECSLogger, ECSFile, ECSLine, ECSError, ECSErrorType,
+	ECSErrorCode, ECSStackTrace, ECSHost, ECSService, ECSVersionKey, ECSVerbosity,
+}
+
+// ECSOutput outputs in JSON format using the Elastic Common Schema (ECS).  Meant for services
+// like the ELK stack.  Note that ECSOutput will overload these properties:
 //
-// import (
-// 	"encoding/json"
-// 	"fmt"
-// 	"io"
-// 	"strings"
-// 	"sync"
-// )
-//
-// // ECSOutput outputs in JSON format using the Elastic ECS format.  Meant for services like the ELK
-// // stack.  Note that ECSOutput will overload these properties:
-// //
-// // * `@timestamp` - when the message was generated
-// // * `message`   - the plaintext log message
-// // * `log.level` - the log level, e.g. debug, info, error
-// // * `verbosity` - the verbosity of the debug message, when relevant
-// // * `package.name`   - the package in which this log message was generated
-// // * `log.origin.file.name`   - the source file in which this log message was generated
-// // * `log.origin.file.line`  - the source code line number that contains this log message
-// // * `error.message` - the error message formatted, if present
-// // * `error.code` - the error code, if the error supports it
-// //
-// type ECSOutput struct {
-// 	sync.Mutex
-//
-// 	Host string
-// 	Out  io.Writer
-// }
-//
-// // NewECSOutput creates a new log output that's meant to be used with the ELK stack.  Supports ECS
-// // fields for the standard fields.  See ECSOutput for details.
-// func NewECSOutput(host string, writer io.Writer) *ECSOutput {
-// 	return &ECSOutput{
-// 		Host: host,
-// 		Out:  writer,
-// 	}
-// }
-//
-// func (w *ECSOutput) Write(m Message, msg string, args ...interface{}) error {
-// 	if m.fields == nil {
-// 		m.fields = Fields{}
-// 	}
-//
-// 	m.fields["@timestamp"] = m.when.UTC().Format(PaddedRFC3339Ms)
-// 	m.fields["host.name"] = w.Host
-//
-// 	if m.debug {
-// 		m.fields["log.level"] = "debug"
-// 		m.fields["verbosity"] = m.verbosity
-// 	} else if m.err == nil {
-// 		m.fields["log.level"] = "info"
-// 	} else {
-// 		m.fields["log.level"] = "error"
-// 	}
-//
-// 	// Write out the human-readable message
-// 	msg = strings.TrimSpace(msg)
-// 	if msg != "" {
-// 		m.fields["message"] = fmt.Sprintf(msg, args...)
-// 	}
-//
-// 	if m.file != "" {
-// 		m.fields["package.name"] = m.pkg
-// 		m.fields["log.origin.file.name"] = m.file
-// 		m.fields["log.origin.file.line"] = m.line
-// 	}
-//
-// 	if m.err != nil {
-// 		m.fields["error.message"] = m.err.Error()
-// 		// TODO: Support error.code
-// 	}
-//
-// 	// Applies any registered context variables to the fields
-// 	contexts.Run(m.ctx, m.fields)
-//
-// 	w.Lock()
-// 	defer w.Unlock()
-//
-// 	enc := json.NewEncoder(w.Out)
-// 	if err := enc.Encode(m.fields); err != nil {
-// 		return err
-// 	}
-//
-// 	if _, err := w.Out.Write(EOL); err != nil {
-// 		return err
-// 	}
+// * `@timestamp` - when the message was generated
+// * `message` - the plaintext log message
+// * `log.level` - the log level, e.g. debug, info, error
+// * `log.logger` - the name of the logger, see Named, or the package in which this log message
+// was generated
+// * `log.origin.file.name` - the package and source file in which this log message was
+// generated, e.g. `billing/invoice.go`
+// * `log.origin.file.line` - the source code line number that contains this log message
+// * `error.message` - the error message formatted, if present
+// * `error.type` - the Go type of the error, if present
+// * `error.code` - the error code, if the error supports it; see ErrorCodeField
+// * `error.*` - any other fields contributed by the error; see LogFielder
+// * `error.stack_trace` - the stack trace of an error message, if enabled
+// * `host.name` - the hostname
+// * `service.name` - the name of the service generating the logs
+// * `ecs.version` - the ECS version, see ECSVersion
+// * `kleos.verbosity` - the verbosity of the debug message, when relevant
 //
-// 	return nil
-// }
+// Field names containing dots, including the custom fields, are expanded into nested JSON
+// objects, so `user.id` is output as `{"user": {"id": ...}}`.  Custom fields that would
+// collide with the fields above get a trailing underscore, so a field named `log` is output
+// as `log_`, rather than replacing the `log` object.
+type ECSOutput struct {
+	sync.Mutex
+
+	Host    string
+	Service string
+
+	out io.Writer
+}
+
+// NewECSOutput creates a new log output that's meant to be used with the ELK stack.  The
+// service is reported as `service.name`, and the host name defaults to the system's host name.
+// See ECSOutput for details.
+func NewECSOutput(service string, writer io.Writer) *ECSOutput {
+	host, _ := os.Hostname()
+
+	return &ECSOutput{
+		Host:    host,
+		Service: service,
+		out:     writer,
+	}
+}
+
+// Write the message to the output as an ECS-compatible JSON document.  Like the JSONOutput,
+// the common field types are encoded without reflection, into a pooled buffer.
+func (w *ECSOutput) Write(m Message) error {
+	// The error's fields are reported under error.*, not alongside the message's fields
+	fields := appendMessageFields(make([]Field, 0, len(m.typed)+16), m.mergeFields(nil), m.typed)
+
+	// The logger's name is reported as log.logger, in place of the package
+	logger := fieldString(fields, LoggerField)
+	if logger == "" {
+		logger = m.pkg
+	}
+
+	custom := fields[:0]
+	for _, f := range fields {
+		if f.Key == LoggerField {
+			continue
+		}
+
+		f.Key = ecsName(f.Key)
+		custom = append(custom, f)
+	}
+	fields = custom
+
+	fields = append(fields,
+		String(ECSTimestamp, m.when.UTC().Format(PaddedRFC3339Ms)),
+		String(ECSVersionKey, ECSVersion),
+		String(ECSLevel, m.Level().String()),
+	)
+
+	if logger != "" {
+		fields = append(fields, String(ECSLogger, logger))
+	}
+
+	if m.verbosity > 0 {
+		fields = append(fields, Int(ECSVerbosity, int(m.verbosity)))
+	}
+
+	if w.Host != "" {
+		fields = append(fields, String(ECSHost, w.Host))
+	}
+
+	if w.Service != "" {
+		fields = append(fields, String(ECSService, w.Service))
+	}
+
+	// Write out the human-readable message
+	if msg := strings.TrimSpace(m.msg); msg != "" {
+		fields = append(fields, String(ECSMessage, msg))
+	}
+
+	if m.file != "" {
+		fields = append(fields, String(ECSFile, path.Join(m.pkg, m.file)), Int(ECSLine, m.line))
+	}
+
+	if m.error != nil {
+		for k, v := range m.ErrorFields() {
+			fields = append(fields, Object("error."+k, v))
+		}
+
+		fields = append(fields, String(ECSError, m.error.Error()))
+		if errType := errorType(m.error); errType != "" {
+			fields = append(fields, String(ECSErrorType, errType))
+		}
+
+		if len(m.stack) > 0 {
+			fields = append(fields, String(ECSStackTrace, stackTrace(m.stack)))
+		}
+	}
+
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	*buf = expand(sortFields(fields)).appendJSON(*buf)
+	*buf = append(*buf, '\n')
+
+	w.Lock()
+	defer w.Unlock()
+
+	_, err := w.out.Write(*buf)
+	return err
+}
+
+// Formats the stack trace like a Go panic, one function per line followed by its indented
+// file and line number.
+func stackTrace(stack []Frame) string {
+	var b strings.Builder
+
+	for _, frame := range stack {
+		_, _ = fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Func, frame.File, frame.Line)
+	}
+
+	return b.String()
+}
+
+// Renames a custom field that collides with one of the fields the ECSOutput writes, adding an
+// underscore to the colliding part of the name.  A field named `log` becomes `log_`, instead
+// of replacing the object holding `log.level`, and `message.text` becomes `message_.text`,
+// instead of turning the message into an object.
+func ecsName(name string) string {
+	for _, reserved := range ecsReserved {
+		switch {
+		case strings.HasPrefix(reserved, name+"."):
+			return name + "_"
+		case strings.HasPrefix(name, reserved+"."):
+			return reserved + "_" + name[len(reserved):]
+		}
+	}
+
+	return name
+}
+
+// A JSON object in an ECS document, with the dotted field names expanded into nested objects.
+type ecsObject struct {
+	names   []string
+	entries []ecsEntry
+}
+
+// A value in an ECS document:  a field, or a nested object.
+type ecsEntry struct {
+	field  Field
+	object *ecsObject
+}
+
+// Expands dotted field names into nested objects, e.g. `log.level` becomes
+// `{"log": {"level": ...}}`.  If a dotted name collides with a value that isn't an object,
+// the dotted name is kept as-is.  The fields must be sorted, so values are placed before any
+// dotted names that collide with them.
+func expand(fields []Field) *ecsObject {
+	root := &ecsObject{}
+
+	for _, f := range fields {
+		parent := root
+		path := strings.Split(f.Key, ".")
+
+		for i, name := range path[:len(path)-1] {
+			child, exists := parent.get(name)
+			if !exists {
+				obj := &ecsObject{}
+				parent.set(name, ecsEntry{object: obj})
+				parent = obj
+				continue
+			}
+
+			if child.object == nil {
+				// Collides with a value; store the rest of the path as a dotted name
+				path = []string{strings.Join(path[i:], ".")}
+				break
+			}
+
+			parent = child.object
+		}
+
+		parent.set(path[len(path)-1], ecsEntry{field: f})
+	}
+
+	return root
+}
+
+// Returns the entry with the name.
+func (o *ecsObject) get(name string) (ecsEntry, bool) {
+	for i, n := range o.names {
+		if n == name {
+			return o.entries[i], true
+		}
+	}
+
+	return ecsEntry{}, false
+}
+
+// Sets the entry with the name, replacing any entry already there.
+func (o *ecsObject) set(name string, entry ecsEntry) {
+	for i, n := range o.names {
+		if n == name {
+			o.entries[i] = entry
+			return
+		}
+	}
+
+	o.names = append(o.names, name)
+	o.entries = append(o.entries, entry)
+}
+
+// Appends the object as JSON, with the keys sorted.  Errors are reported by their message;
+// encoding/json would output most of them as `{}`.
+func (o *ecsObject) appendJSON(b []byte) []byte {
+	sort.Sort(o)
+
+	b = append(b, '{')
+
+	for i, name := range o.names {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendJSONString(b, name)
+		b = append(b, ':')
+
+		if entry := o.entries[i]; entry.object != nil {
+			b = entry.object.appendJSON(b)
+		} else {
+			b = appendJSONField(b, entry.field)
+		}
+	}
+
+	return append(b, '}')
+}
+
+func (o *ecsObject) Len() int           { return len(o.names) }
+func (o *ecsObject) Less(i, j int) bool { return o.names[i] < o.names[j] }
+
+func (o *ecsObject) Swap(i, j int) {
+	o.names[i], o.names[j] = o.names[j], o.names[i]
+	o.entries[i], o.entries[j] = o.entries[j], o.entries[i]
+}
@@ -0,0 +1,202 @@
+package kleos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var timestamps = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z`)
+
+// Compares the output to the golden file in testdata, ignoring timestamps.  Run the tests
+// with -update to regenerate the golden files.
+func golden(t *testing.T, name string, output []byte) {
+	t.Helper()
+
+	output = timestamps.ReplaceAll(output, []byte("2006-01-02T15:04:05.000Z"))
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.WriteFile(path, output, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(expected), string(output))
+}
+
+type notFoundError struct {
+	id string
+}
+
+func (e *notFoundError) Error() string {
+	return "record " + e.id + " not found"
+}
+
+func ecsLogger(out *bytes.Buffer) *kleos.Kleos {
+	ecs := kleos.NewECSOutput("billing", out)
+	ecs.Host = "test-host"
+
+	log := kleos.New()
+	log.SetOutput(ecs)
+	log.SetVerbosity(2)
+	log.EnableSource(false)
+
+	return log
+}
+
+func TestECSGolden(t *testing.T) {
+	var out bytes.Buffer
+	log := ecsLogger(&out)
+
+	log.With(kleos.Fields{
+		"user.id":   5,
+		"user.name": "bob",
+		"tenant":    "acme",
+	}).Log("Registered new user")
+	golden(t, "ecs_info", out.Bytes())
+	out.Reset()
+
+	log.Error(&notFoundError{"B8012423573231"}).With(kleos.Fields{
+		"http.response.status_code": 404,
+	}).Log("Unable to find invoice")
+	golden(t, "ecs_error", out.Bytes())
+	out.Reset()
+
+	log.V(2).Log("Checked cache")
+	golden(t, "ecs_debug", out.Bytes())
+	out.Reset()
+}
+
+// Fields the ECSOutput is allowed to generate, from the ECS 8.x field reference.
+var ecsFields = map[string]bool{
+	"@timestamp":           true,
+	"message":              true,
+	"ecs.version":          true,
+	"log.level":            true,
+	"log.logger":           true,
+	"log.origin.file.name": true,
+	"log.origin.file.line": true,
+	"error.message":        true,
+	"error.type":           true,
+	"error.code":           true,
+	"error.stack_trace":    true,
+	"host.name":            true,
+	"service.name":         true,
+	"kleos.verbosity":      true,
+}
+
+// Flattens the nested JSON objects back into dotted field names.
+func flatten(prefix string, doc map[string]any, into map[string]any) {
+	for k, v := range doc {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+
+		if obj, ok := v.(map[string]any); ok {
+			flatten(k, obj, into)
+			continue
+		}
+
+		into[k] = v
+	}
+}
+
+// Parses the ECS document and flattens it, checking that only ECS fields were written.
+func ecsDocument(t *testing.T, out *bytes.Buffer, custom ...string) map[string]any {
+	t.Helper()
+
+	var doc map[string]any
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[string]any)
+	flatten("", doc, fields)
+
+	allowed := make(map[string]bool)
+	for _, k := range custom {
+		allowed[k] = true
+	}
+
+	for k := range fields {
+		assert.True(t, ecsFields[k] || allowed[k], "%s is not an ECS field", k)
+	}
+
+	return fields
+}
+
+func TestECSFieldSet(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out bytes.Buffer
+		log := ecsLogger(&out)
+		log.EnableSource(true)
+		log.SetStackDepth(10)
+
+		log.Error(errors.New("connection refused")).Log("Unable to connect to the database")
+
+		fields := ecsDocument(t, &out)
+		assert.Equal("error", fields["log.level"])
+		assert.Equal("kleos/ecs_output_test.go", fields["log.origin.file.name"])
+		assert.Equal("kleos", fields["log.logger"])
+		assert.Equal("connection refused", fields["error.message"])
+		assert.Equal("*errors.errorString", fields["error.type"])
+		assert.Contains(fields["error.stack_trace"], "kleos_test.TestECSFieldSet")
+		assert.True(strings.HasSuffix(out.String(), "\n"))
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out bytes.Buffer
+		log := ecsLogger(&out)
+		log.EnableSource(true)
+
+		log.Named("invoices").V(2).Log("Checked cache")
+
+		fields := ecsDocument(t, &out)
+		assert.Equal("debug", fields["log.level"])
+		assert.Equal(float64(2), fields["kleos.verbosity"])
+		assert.Equal("invoices", fields["log.logger"])
+		assert.Equal("kleos/ecs_output_test.go", fields["log.origin.file.name"])
+		assert.NotContains(fields, "logger")
+	})
+
+	t.Run("collisions", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out bytes.Buffer
+		log := ecsLogger(&out)
+
+		log.Error(errors.New("timeout")).
+			With(kleos.Fields{"log": "audit", "message.id": 7}).
+			Add(kleos.String("error", "retrying")).
+			Log("Unable to reach the payment provider")
+
+		fields := ecsDocument(t, &out, "log_", "error_", "message_.id")
+		assert.Equal("error", fields["log.level"])
+		assert.Equal("timeout", fields["error.message"])
+		assert.Equal("Unable to reach the payment provider", fields["message"])
+		assert.Equal("audit", fields["log_"])
+		assert.Equal("retrying", fields["error_"])
+		assert.Equal(float64(7), fields["message_.id"])
+	})
+}
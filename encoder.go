@@ -1,10 +1,9 @@
 package kleos
 
 import (
-	"fmt"
-	"strconv"
 	"strings"
-	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -15,53 +14,163 @@ const (
 	RFC3339Ms = "2006-01-02T15:04:05.999Z07:00"
 )
 
-// Encode a field value for output.
-func encode(value interface{}) string {
-	switch v := value.(type) {
-	case int:
-		return strconv.FormatInt(int64(v), 10)
-	case int32:
-		return strconv.FormatInt(int64(v), 10)
-	case int64:
-		return strconv.FormatInt(v, 10)
-	case float32:
-		return strconv.FormatFloat(float64(v), 'f', 5, 32)
-	case float64:
-		return strconv.FormatFloat(v, 'f', 5, 64)
-	case bool:
-		return strconv.FormatBool(v)
-	case string:
-		if strings.Contains(v, " ") {
-			return strconv.Quote(v)
+// Encode a field value as plain text, without quotes, for outputs that escape the values
+// themselves.
+func encodePlain(value interface{}) string {
+	return TextFormat{}.plain(value)
+}
+
+// Encode a typed field's value as plain text, without boxing it.  See encodePlain.
+func encodePlainField(f Field) string {
+	return TextFormat{}.plainField(f)
+}
+
+// Encode a string as a logfmt value:  quoted if it contains spaces, equals signs, quotes, or
+// anything unprintable, such as a newline or the escape that starts an ANSI sequence.  Quoted
+// strings escape quotes, backslashes, and unprintable characters the same way Go does, so a
+// value can't break out of its quotes or onto another line.
+func encodeString(s string) string {
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || !printable(r) {
+			return quoteString(s)
 		}
-		return v
-	case error:
-		return strconv.Quote(v.Error())
-	case uuid.UUID:
-		if BlankUUID(v) {
-			return ""
+	}
+
+	return s
+}
+
+// Quotes and escapes the string.  See encodeString.
+func quoteString(s string) string {
+	b := make([]byte, 0, len(s)+2)
+
+	b = append(b, '"')
+	b = appendEscaped(b, s, true)
+
+	return string(append(b, '"'))
+}
+
+// Escapes the log message, so it can't add lines to the log, write ANSI sequences to the
+// terminal, or pass for the fields and source that follow it.  Backslashes and unprintable
+// characters are escaped, e.g. "\\" and "\n", as is the comma of a ", key=" and the
+// parenthesis of a " (pkg/file.go:42)", e.g. "\,".  See unescapeText.
+func sanitizeText(s string) string {
+	if !needsEscaping(s) {
+		return s
+	}
+
+	b := make([]byte, 0, len(s)+8)
+	last := 0
+
+	for i := 0; i < len(s); i++ {
+		if forgesTail(s, i) {
+			b = appendEscaped(b, s[last:i], false)
+			b = append(b, '\\', s[i])
+			last = i + 1
 		}
-		return v.String()
-	case time.Time:
-		if v.IsZero() {
-			return ""
+	}
+
+	return string(appendEscaped(b, s[last:], false))
+}
+
+// Does the log message need escaping?  See sanitizeText.
+func needsEscaping(s string) bool {
+	for i, r := range s {
+		if r == '\\' || r != ' ' && !printable(r) || forgesTail(s, i) {
+			return true
 		}
-		return v.Format(RFC3339Ms)
-	case fmt.Stringer:
-		res := v.String()
-		if strings.Contains(res, " ") {
-			res = strconv.Quote(res)
+	}
+
+	return false
+}
+
+// Would the log message, from i on, pass for the fields or source the text outputs write after
+// it?  True for the comma of a ", key=" and the parenthesis of a " (pkg/file.go:42)".
+func forgesTail(s string, i int) bool {
+	switch s[i] {
+	case ',':
+		field, ok := strings.CutPrefix(s[i+1:], " ")
+		eq := strings.IndexByte(field, '=')
+
+		return ok && eq > 0 && !strings.ContainsAny(field[:eq], " \",")
+	case '(':
+		if i > 0 && s[i-1] != ' ' {
+			return false
 		}
-		res = Cleanup(res)
-		return res
+
+		_, _, _, _, ok := parseTextSource(s[i:])
+		return ok
 	default:
-		res := fmt.Sprintf("%v", value)
-		if strings.Contains(res, " ") {
-			res = strconv.Quote(res)
+		return false
+	}
+}
+
+// Replaces the characters that aren't allowed in a logfmt key with underscores:  spaces,
+// equals signs, quotes, and anything unprintable.
+func sanitizeKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || !printable(r) {
+			return strings.Map(func(r rune) rune {
+				if r <= ' ' || r == '=' || r == '"' || !printable(r) {
+					return '_'
+				}
+				return r
+			}, key)
+		}
+	}
+
+	return key
+}
+
+// Is the rune printable, and not an invalid byte?  Also false for spaces other than the
+// ASCII space, such as a non-breaking space.
+func printable(r rune) bool {
+	return r != utf8.RuneError && unicode.IsPrint(r)
+}
+
+// Appends the string with its backslashes and unprintable characters escaped, e.g. "\n" or
+// "\u001b".  If the string is quoted, escapes quotes as well.  Invalid UTF-8 is replaced with
+// "\ufffd".
+func appendEscaped(b []byte, s string, quoted bool) []byte {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		switch {
+		case r == '\\':
+			b = append(b, '\\', '\\')
+		case r == '"':
+			if quoted {
+				b = append(b, '\\')
+			}
+			b = append(b, '"')
+		case r == ' ':
+			b = append(b, ' ')
+		case r == '\n':
+			b = append(b, '\\', 'n')
+		case r == '\r':
+			b = append(b, '\\', 'r')
+		case r == '\t':
+			b = append(b, '\\', 't')
+		case r == utf8.RuneError && size == 1:
+			b = append(b, `\ufffd`...)
+		case !unicode.IsPrint(r):
+			if r > 0xffff {
+				b = append(b, '\\', 'U', '0', '0')
+				b = append(b, hexDigits[r>>20&0xf], hexDigits[r>>16&0xf])
+			} else {
+				b = append(b, '\\', 'u')
+			}
+			b = append(b, hexDigits[r>>12&0xf], hexDigits[r>>8&0xf], hexDigits[r>>4&0xf], hexDigits[r&0xf])
+		default:
+			b = append(b, s[i-size:i]...)
 		}
-		res = Cleanup(res)
-		return res
 	}
+
+	return b
 }
 
 // BlankUUID checks to see if the uuid.UUID value is blank.
@@ -75,9 +184,9 @@ func BlankUUID(id uuid.UUID) bool {
 	return true
 }
 
-// Cleanup removes carriage return characters from the string.
+// Cleanup removes newline and carriage return characters from the string.
 func Cleanup(v string) string {
-	v = strings.ReplaceAll(v, `\n`, "")
-	v = strings.ReplaceAll(v, `\r`, "")
+	v = strings.ReplaceAll(v, "\n", "")
+	v = strings.ReplaceAll(v, "\r", "")
 	return v
 }
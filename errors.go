@@ -0,0 +1,129 @@
+package kleos
+
+import (
+	"reflect"
+)
+
+// ErrorCodeField is the field holding an error code, as returned by a LogFielder.  The
+// ECSOutput reports it as `error.code`.
+const ErrorCodeField = "code"
+
+// Most errors to report in an error chain.
+const maxErrorChain = 32
+
+// LogFielder is implemented by errors that add their own fields to the log message, such as
+// an error code, HTTP status, or the ID of the record that caused the problem:
+//
+//	func (e *NotFoundError) LogFields() kleos.Fields {
+//		return kleos.Fields{"code": "not_found", "status": 404, "id": e.ID}
+//	}
+//
+// Every error in the chain of wrapped errors may contribute fields.  Fields from outer errors
+// take precedence over those from the errors they wrap.
+type LogFielder interface {
+	LogFields() Fields
+}
+
+// ErrorLink is an error in a chain of wrapped errors.
+type ErrorLink struct {
+	Msg  string `json:"msg"`
+	Type string `json:"type"`
+}
+
+// ErrorChain returns the message's error followed by every error it wraps, depth first,
+// including those combined with errors.Join.  Returns nil if the message doesn't have an
+// error.
+func (m Message) ErrorChain() []ErrorLink {
+	var chain []ErrorLink
+
+	for _, err := range unwrapAll(m.error) {
+		chain = append(chain, ErrorLink{
+			Msg:  err.Error(),
+			Type: errorType(err),
+		})
+	}
+
+	return chain
+}
+
+// ErrorFields returns the fields contributed by the message's error and the errors it wraps.
+// See LogFielder.
+func (m Message) ErrorFields() Fields {
+	if m.resolved {
+		if len(m.errFields) == 0 {
+			return nil
+		}
+
+		fields := make(Fields, len(m.errFields))
+		for k, v := range m.errFields {
+			fields[k] = v
+		}
+
+		return fields
+	}
+
+	errs := unwrapAll(m.error)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var fields Fields
+
+	// Innermost errors first, so the outer errors override them
+	for i := len(errs) - 1; i >= 0; i-- {
+		fielder, ok := errs[i].(LogFielder)
+		if !ok {
+			continue
+		}
+
+		if fields == nil {
+			fields = make(Fields)
+		}
+
+		for k, v := range fielder.LogFields() {
+			fields[k] = v
+		}
+	}
+
+	return fields
+}
+
+// Returns the error followed by every error it wraps, depth first.
+func unwrapAll(err error) []error {
+	var errs []error
+
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || len(errs) >= maxErrorChain {
+			return
+		}
+
+		errs = append(errs, err)
+
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, child := range e.Unwrap() {
+				walk(child)
+			}
+		}
+	}
+
+	walk(err)
+
+	return errs
+}
+
+// Returns the Go type of the error, e.g. "*fs.PathError".  Errors parsed from log output
+// report the type of the original error, or nothing if it's unknown.
+func errorType(err error) string {
+	switch e := err.(type) {
+	case *redactedError:
+		err = e.err
+	case *parsedError:
+		return e.typ
+	}
+
+	return reflect.TypeOf(err).String()
+}
@@ -0,0 +1,158 @@
+package kleos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// A domain error that contributes its own fields.
+type invoiceError struct {
+	id     string
+	status int
+}
+
+func (e *invoiceError) Error() string {
+	return "invoice " + e.id + " is locked"
+}
+
+func (e *invoiceError) LogFields() kleos.Fields {
+	return kleos.Fields{
+		"code":    "invoice_locked",
+		"status":  e.status,
+		"invoice": e.id,
+	}
+}
+
+// Wraps another error, overriding some of its fields.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.err)
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func (e *httpError) LogFields() kleos.Fields {
+	return kleos.Fields{"status": e.status}
+}
+
+func TestErrorChain(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(&out))
+
+	_, err := os.Open("/does/not/exist")
+	log.Error(fmt.Errorf("loading config: %w", err)).Log("Unable to start")
+
+	var doc struct {
+		Err   string            `json:"err"`
+		Type  string            `json:"err_type"`
+		Chain []kleos.ErrorLink `json:"err_chain"`
+	}
+	assert.NoError(json.Unmarshal(out.Bytes(), &doc))
+
+	assert.Equal("*fmt.wrapError", doc.Type)
+	if assert.Len(doc.Chain, 3) {
+		assert.Equal(doc.Err, doc.Chain[0].Msg)
+		assert.Equal("*fs.PathError", doc.Chain[1].Type)
+		assert.Equal("syscall.Errno", doc.Chain[2].Type)
+	}
+	out.Reset()
+
+	// Errors that don't wrap anything have no chain
+	log.Error(errors.New("yikes")).Log("Unable to start")
+	assert.Contains(out.String(), `"err_type":"*errors.errorString"`)
+	assert.NotContains(out.String(), "err_chain")
+}
+
+func TestJoinedErrorChain(t *testing.T) {
+	first := errors.New("first")
+	second := fmt.Errorf("second: %w", errors.New("cause"))
+
+	m := kleos.New().Error(errors.Join(first, second))
+
+	var msgs []string
+	for _, link := range m.ErrorChain() {
+		msgs = append(msgs, link.Msg)
+	}
+
+	assert.Equal(t, []string{"first\nsecond: cause", "first", "second: cause", "cause"}, msgs)
+}
+
+func TestErrorFields(t *testing.T) {
+	assert := assert.New(t)
+
+	var text, js bytes.Buffer
+
+	log := kleos.New().Bind(kleos.Fields{"invoice": "bound", "tenant": "acme"})
+	log.SetOutput(kleos.Tee(kleos.NewTextOutput(&text), kleos.NewJSONOutput(&js)))
+
+	err := fmt.Errorf("saving: %w", &httpError{
+		status: 409,
+		err:    &invoiceError{id: "INV-42", status: 500},
+	})
+
+	log.Error(err).With(kleos.Fields{"code": "call_site"}).Log("Unable to save invoice")
+
+	output := text.String()
+	assert.Contains(output, "invoice=INV-42") // the error overrides the bound field
+	assert.Contains(output, "status=409")     // the outer error overrides the inner error
+	assert.Contains(output, "code=call_site") // the call site overrides the error
+	assert.Contains(output, "tenant=acme")
+
+	var doc map[string]any
+	assert.NoError(json.Unmarshal(js.Bytes(), &doc))
+	assert.Equal("INV-42", doc["invoice"])
+	assert.Equal(float64(409), doc["status"])
+}
+
+func TestECSErrorCode(t *testing.T) {
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewECSOutput("billing", &out))
+	log.Error(&invoiceError{id: "INV-42", status: 423}).Log("Unable to save invoice")
+
+	assert.Contains(t, out.String(), `"error":{"code":"invoice_locked","invoice":"INV-42","message":"invoice INV-42 is locked","status":423,"type":"*kleos_test.invoiceError"}`)
+	assert.NotContains(t, out.String(), `"code":"invoice_locked","error"`)
+
+	// The error's fields stay under error.* when redacted, and fields passed to With stay at
+	// the top
+	out.Reset()
+
+	redactor, err := kleos.NewRedactor(kleos.RedactKey("invoice", kleos.RedactMask))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.SetOutput(redactor.Wrap(kleos.NewECSOutput("billing", &out)))
+	log.Error(&invoiceError{id: "INV-42", status: 423}).With(kleos.Fields{"status": 200}).Log("Unable to save invoice")
+
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, map[string]any{
+		"code":    "invoice_locked",
+		"invoice": kleos.RedactedMask,
+		"message": "invoice INV-42 is locked",
+		"status":  float64(423),
+		"type":    "*kleos_test.invoiceError",
+	}, doc["error"])
+	assert.Equal(t, float64(200), doc["status"])
+	assert.NotContains(t, doc, "code")
+	assert.NotContains(t, doc, "invoice")
+}
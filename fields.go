@@ -1,4 +1,246 @@
 package kleos
 
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
 // Fields holds details about the log message.
 type Fields map[string]any
+
+// Field is a typed detail about the log message, created with String, Int, Duration, and so
+// on.  Unlike Fields, typed fields don't allocate a map or box their values, and the text
+// outputs list them in the order they were added:
+//
+//	log.Add(kleos.String("user", id), kleos.Int("rows", n)).Log("Saved")
+//
+// The built-in outputs encode typed fields directly, without reflection.
+type Field struct {
+	Key string
+
+	kind  fieldKind
+	num   int64       // integers, floats, bools, durations, times, and the first half of UUIDs
+	ext   uint64      // the second half of UUIDs
+	str   string      // strings
+	value interface{} // errors, objects, and time zones
+}
+
+// The type of value held by a Field.
+type fieldKind uint8
+
+const (
+	objectField fieldKind = iota
+	stringField
+	intField
+	int64Field
+	float64Field
+	boolField
+	durationField
+	timeField
+	uuidField
+	errorField
+)
+
+// String creates a string field.
+func String(key, value string) Field {
+	return Field{Key: key, kind: stringField, str: value}
+}
+
+// Int creates an integer field.
+func Int(key string, value int) Field {
+	return Field{Key: key, kind: intField, num: int64(value)}
+}
+
+// Int64 creates a 64-bit integer field.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, kind: int64Field, num: value}
+}
+
+// Float64 creates a floating point field.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, kind: float64Field, num: int64(math.Float64bits(value))}
+}
+
+// Bool creates a boolean field.
+func Bool(key string, value bool) Field {
+	f := Field{Key: key, kind: boolField}
+	if value {
+		f.num = 1
+	}
+
+	return f
+}
+
+// Duration creates a time.Duration field.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, kind: durationField, num: int64(value)}
+}
+
+// Time creates a time.Time field.
+func Time(key string, value time.Time) Field {
+	// Times that can't be represented in nanoseconds since the epoch are kept as is
+	if year := value.Year(); value.IsZero() || year < 1678 || year > 2261 {
+		return Field{Key: key, kind: timeField, value: value}
+	}
+
+	return Field{Key: key, kind: timeField, num: value.UnixNano(), value: value.Location()}
+}
+
+// UUID creates a uuid.UUID field.
+func UUID(key string, value uuid.UUID) Field {
+	return Field{
+		Key:  key,
+		kind: uuidField,
+		num:  int64(binary.BigEndian.Uint64(value[:8])),
+		ext:  binary.BigEndian.Uint64(value[8:]),
+	}
+}
+
+// Err creates a field holding an error.  It's not the message's error; use Error for that.
+func Err(key string, err error) Field {
+	return Field{Key: key, kind: errorField, value: err}
+}
+
+// Object creates a field holding any other value, encoded the same way as a value in Fields.
+func Object(key string, value interface{}) Field {
+	return Field{Key: key, kind: objectField, value: value}
+}
+
+// Value returns the field's value as the type it was created with, e.g. an int for Int.
+func (f Field) Value() interface{} {
+	switch f.kind {
+	case stringField:
+		return f.str
+	case intField:
+		return int(f.num)
+	case int64Field:
+		return f.num
+	case float64Field:
+		return f.float()
+	case boolField:
+		return f.num == 1
+	case durationField:
+		return time.Duration(f.num)
+	case timeField:
+		return f.time()
+	case uuidField:
+		return f.uuid()
+	}
+
+	return f.value
+}
+
+func (f Field) float() float64 {
+	return math.Float64frombits(uint64(f.num))
+}
+
+func (f Field) time() time.Time {
+	if t, ok := f.value.(time.Time); ok {
+		return t
+	}
+
+	return time.Unix(0, f.num).In(f.value.(*time.Location))
+}
+
+func (f Field) uuid() uuid.UUID {
+	var id uuid.UUID
+	binary.BigEndian.PutUint64(id[:8], uint64(f.num))
+	binary.BigEndian.PutUint64(id[8:], f.ext)
+
+	return id
+}
+
+// Returns the fields without any repeated keys, keeping the last value for each key.  Only
+// copies the fields if there are repeats.
+func uniqueFields(fields []Field) []Field {
+	for i := range fields {
+		if !repeated(fields, i) {
+			continue
+		}
+
+		unique := make([]Field, 0, len(fields)-1)
+		for j, f := range fields {
+			if !repeated(fields, j) {
+				unique = append(unique, f)
+			}
+		}
+
+		return unique
+	}
+
+	return fields
+}
+
+// Is the key of the field at index i repeated later in the fields?
+func repeated(fields []Field, i int) bool {
+	for _, f := range fields[i+1:] {
+		if f.Key == fields[i].Key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sorts the fields by key, keeping the last value of any repeated key.  Sorts in place.
+func sortFields(fields []Field) []Field {
+	sort.Stable(fieldsByKey(fields))
+
+	unique := fields[:0]
+	for i, f := range fields {
+		if i+1 < len(fields) && fields[i+1].Key == f.Key {
+			continue
+		}
+
+		unique = append(unique, f)
+	}
+
+	return unique
+}
+
+// Sorts fields by key.
+type fieldsByKey []Field
+
+func (f fieldsByKey) Len() int           { return len(f) }
+func (f fieldsByKey) Less(i, j int) bool { return f[i].Key < f[j].Key }
+func (f fieldsByKey) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// Appends the message's fields other than the typed fields, followed by the typed fields, so
+// the typed fields take precedence.  The untyped values are wrapped with Object.
+func appendMessageFields(dst []Field, fields Fields, typed []Field) []Field {
+	for k, v := range fields {
+		dst = append(dst, Object(k, v))
+	}
+
+	return append(dst, typed...)
+}
+
+// Finds the last field with the given key.
+func findField(fields []Field, key string) (Field, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == key {
+			return fields[i], true
+		}
+	}
+
+	return Field{}, false
+}
+
+// Returns the value of the last field with the given key, if it's a string.
+func fieldString(fields []Field, key string) string {
+	f, ok := findField(fields, key)
+	if !ok {
+		return ""
+	}
+
+	if f.kind == stringField {
+		return f.str
+	}
+
+	s, _ := f.value.(string)
+	return s
+}
@@ -0,0 +1,187 @@
+package kleos_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	typedID   = uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	typedTime = time.Date(2024, 3, 9, 17, 4, 5, 120000000, time.FixedZone("EST", -5*3600))
+	typedErr  = errors.New("connection reset")
+)
+
+// The same values as typed fields and as Fields, in alphabetical order.
+func typedFields() ([]kleos.Field, kleos.Fields) {
+	typed := []kleos.Field{
+		kleos.Bool("active", true),
+		kleos.Err("cause", typedErr),
+		kleos.Time("checked", typedTime),
+		kleos.Int64("count", -1<<40),
+		kleos.UUID("id", typedID),
+		kleos.Duration("latency", 1500*time.Millisecond),
+		kleos.String("name", "NBC Sports"),
+		kleos.Object("point", jsonPoint{1, 2}),
+		kleos.Float64("ratio", 0.25),
+		kleos.Int("rows", 97),
+		kleos.Time("started", time.Time{}),
+		kleos.UUID("tenant", uuid.UUID{}),
+	}
+
+	fields := kleos.Fields{}
+	for _, f := range typed {
+		fields[f.Key] = f.Value()
+	}
+
+	return typed, fields
+}
+
+func TestFieldValues(t *testing.T) {
+	assert := assert.New(t)
+
+	_, fields := typedFields()
+
+	assert.Equal(true, fields["active"])
+	assert.Equal(typedErr, fields["cause"])
+	assert.True(typedTime.Equal(fields["checked"].(time.Time)))
+	assert.Equal(typedTime.Location(), fields["checked"].(time.Time).Location())
+	assert.Equal(int64(-1<<40), fields["count"])
+	assert.Equal(typedID, fields["id"])
+	assert.Equal(1500*time.Millisecond, fields["latency"])
+	assert.Equal("NBC Sports", fields["name"])
+	assert.Equal(jsonPoint{1, 2}, fields["point"])
+	assert.Equal(0.25, fields["ratio"])
+	assert.Equal(97, fields["rows"])
+	assert.True(fields["started"].(time.Time).IsZero())
+	assert.Equal(uuid.UUID{}, fields["tenant"])
+}
+
+func TestTypedFieldsEncoding(t *testing.T) {
+	typed, fields := typedFields()
+
+	for name, output := range map[string]func(io.Writer) kleos.Writer{
+		"text": func(w io.Writer) kleos.Writer { return kleos.NewTextOutput(w) },
+		"json": func(w io.Writer) kleos.Writer { return kleos.NewJSONOutput(w) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var fromTyped, fromFields bytes.Buffer
+
+			log := kleos.New()
+			log.EnableSource(false)
+
+			log.SetOutput(output(&fromTyped))
+			log.Add(typed...).Log("Hello World")
+
+			log.SetOutput(output(&fromFields))
+			log.With(fields).Log("Hello World")
+
+			// Skip the timestamps
+			assert.Equal(t, trimTimestamp(fromFields.String()), trimTimestamp(fromTyped.String()))
+		})
+	}
+}
+
+// Removes the timestamp from a text or JSON log line.
+func trimTimestamp(line string) string {
+	if i := strings.Index(line, `"ts":`); i >= 0 {
+		return line[:i]
+	}
+
+	return line[strings.IndexByte(line, ' '):]
+}
+
+func TestTypedFieldsOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.EnableSource(false)
+
+	log.Named("billing").
+		With(kleos.Fields{"user": "overridden", "amount": 12}).
+		Add(kleos.String("user", "bob"), kleos.Int("rows", 3)).
+		Add(kleos.String("status", "ok"), kleos.Int("rows", 4)).
+		Log("Charged")
+
+	// Typed fields in the order added, then the rest alphabetically
+	assert.True(strings.HasSuffix(out.String(),
+		" INF Charged, user=bob, status=ok, rows=4, amount=12, logger=billing\n"), out.String())
+}
+
+func TestTypedFieldsDerived(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+
+	base := log.Add(kleos.String("a", "1"), kleos.String("b", "2"))
+	base = base.Add(kleos.String("c", "3"))
+
+	first := base.Add(kleos.String("d", "4"))
+	second := base.Add(kleos.String("e", "5"))
+
+	first.Log("First")
+	assert.Contains(out.String(), "a=1, b=2, c=3, d=4\n")
+
+	out.Reset()
+	second.Log("Second")
+	assert.Contains(out.String(), "a=1, b=2, c=3, e=5\n")
+}
+
+func TestTypedFieldsFiltered(t *testing.T) {
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewMultiWriter().
+		Add(kleos.NewTextOutput(&out), kleos.FieldEquals("tenant", "acme")))
+
+	log.Add(kleos.String("tenant", "other")).Log("Skipped")
+	log.Add(kleos.String("tenant", "acme")).Log("Logged")
+
+	assert.NotContains(t, out.String(), "Skipped")
+	assert.Contains(t, out.String(), "Logged")
+}
+
+func BenchmarkTypedFields(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	for n := 0; n < b.N; n++ {
+		log.V(1).Add(
+			kleos.String("id", "B8012423573231"),
+			kleos.String("name", "NBC Sports"),
+			kleos.Int("health", 97),
+		).Log("Database is having serious issues related to connections")
+	}
+}
+
+func BenchmarkMapFields(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	for n := 0; n < b.N; n++ {
+		log.V(1).With(kleos.Fields{
+			"id":     "B8012423573231",
+			"name":   "NBC Sports",
+			"health": 97,
+		}).Log("Database is having serious issues related to connections")
+	}
+}
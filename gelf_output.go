@@ -0,0 +1,354 @@
+package kleos
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// GELFVersion is the version of the Graylog Extended Log Format the GELFOutput produces.
+const GELFVersion = "1.1"
+
+// GELF chunk sizes.  Graylog recommends small chunks when sending over the Internet.
+const (
+	GELFChunkSizeWAN = 1420
+	GELFChunkSizeLAN = 8154
+)
+
+// Graylog rejects UDP messages split into more than 128 chunks.
+const gelfMaxChunks = 128
+
+// Size of the header on each chunk:  two magic bytes, an eight byte message ID, the sequence
+// number, and the number of chunks.
+const gelfChunkHeader = 12
+
+// ErrGELFTooLarge returned when a message is too large to send over UDP, even in chunks.
+var ErrGELFTooLarge = errors.New("GELF message too large to chunk")
+
+// Additional field names may only contain letters, numbers, underscores, dashes, and dots.
+var gelfInvalidName = regexp.MustCompile(`[^\w.\-]`)
+
+// GELFCompression is how UDP messages sent to Graylog are compressed.
+type GELFCompression uint8
+
+const (
+	// GELFUncompressed sends the messages as plain JSON.
+	GELFUncompressed GELFCompression = iota
+
+	// GELFGzip compresses the messages with gzip.
+	GELFGzip
+
+	// GELFZlib compresses the messages with zlib.
+	GELFZlib
+)
+
+// GELFOutput is a Writer that sends log messages to Graylog in the Graylog Extended Log Format
+// (GELF), over UDP or TCP.
+//
+// The message is sent as the `short_message`.  If the message has more than one line, or the
+// message has an error or stack trace, the full message, error, and stack trace are sent as
+// the `full_message`.  The level is sent as a syslog severity, e.g. 6 for info messages; see
+// SyslogOutput.
+//
+// The fields are sent as additional fields, prefixed with an underscore, e.g. `_user`.
+// Characters Graylog doesn't allow in field names are replaced with underscores, and the
+// reserved `id` field is sent as `_id_`.  The source is sent as `_pkg`, `_file`, and `_line`,
+// the verbosity of debug messages as `_verbosity`, and the error as `_error` and
+// `_error_type`.
+//
+// Over UDP, messages may be compressed, and messages larger than ChunkSize are split into
+// chunks.  Over TCP, messages are uncompressed and delimited by a null byte, as Graylog
+// expects.
+//
+// Configure the GELFOutput before writing to it.
+type GELFOutput struct {
+	sync.Mutex
+
+	Host        string          // the host sending the messages; defaults to the system's host name
+	Compression GELFCompression // how to compress UDP messages; ignored for TCP
+	ChunkSize   int             // the largest UDP datagram to send; defaults to GELFChunkSizeWAN
+
+	network string
+	addr    string
+	conn    net.Conn
+	closed  bool
+}
+
+// DialGELF connects to the Graylog GELF input.  The network may be "udp" or "tcp".
+func DialGELF(network, addr string) (*GELFOutput, error) {
+	host, _ := os.Hostname()
+
+	w := &GELFOutput{
+		Host:      host,
+		ChunkSize: GELFChunkSizeWAN,
+		network:   network,
+		addr:      addr,
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	w.conn = conn
+
+	return w, nil
+}
+
+// Close the connection to Graylog.  Writing to the output after closing it returns
+// ErrWriterClosed.
+func (w *GELFOutput) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.closed = true
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
+
+// Write the message to Graylog.  If the connection was lost, reconnects and tries once more.
+// Other errors, such as ErrGELFTooLarge, are returned without reconnecting.
+func (w *GELFOutput) Write(m Message) error {
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	*buf = w.appendDocument(*buf, m)
+
+	doc := *buf
+	tcp := strings.HasPrefix(w.network, "tcp")
+
+	if tcp {
+		doc = append(doc, 0)
+		*buf = doc
+	} else {
+		var err error
+		if doc, err = w.compress(doc); err != nil {
+			return err
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if w.conn != nil {
+		err := w.send(doc, tcp)
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) {
+			return err
+		}
+
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	conn, err := net.Dial(w.network, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+
+	return w.send(doc, tcp)
+}
+
+// Sends the GELF document, in chunks if necessary.  Must be called with the mutex held.
+func (w *GELFOutput) send(doc []byte, tcp bool) error {
+	size := w.ChunkSize
+	if size <= gelfChunkHeader {
+		size = GELFChunkSizeWAN
+	}
+
+	if tcp || len(doc) <= size {
+		_, err := w.conn.Write(doc)
+		return err
+	}
+
+	size -= gelfChunkHeader
+
+	count := (len(doc) + size - 1) / size
+	if count > gelfMaxChunks {
+		return ErrGELFTooLarge
+	}
+
+	chunk := make([]byte, gelfChunkHeader, gelfChunkHeader+size)
+	chunk[0] = 0x1e
+	chunk[1] = 0x0f
+
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return err
+	}
+
+	chunk[11] = byte(count)
+
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(doc) {
+			end = len(doc)
+		}
+
+		chunk[10] = byte(i)
+		chunk = append(chunk[:gelfChunkHeader], doc[i*size:end]...)
+
+		if _, err := w.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compresses the GELF document, if requested.
+func (w *GELFOutput) compress(doc []byte) ([]byte, error) {
+	var b bytes.Buffer
+	var z io.WriteCloser
+
+	switch w.Compression {
+	case GELFGzip:
+		z = gzip.NewWriter(&b)
+	case GELFZlib:
+		z = zlib.NewWriter(&b)
+	default:
+		return doc, nil
+	}
+
+	if _, err := z.Write(doc); err != nil {
+		return nil, err
+	}
+
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Appends the GELF document for the message, with the keys sorted.  The common field types
+// are encoded without reflection.
+func (w *GELFOutput) appendDocument(b []byte, m Message) []byte {
+	fields := appendMessageFields(make([]Field, 0, len(m.typed)+16), m.untypedFields(), m.typed)
+	for i := range fields {
+		fields[i].Key = gelfName(fields[i].Key)
+	}
+
+	msg := strings.TrimSpace(m.msg)
+
+	short := msg
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = strings.TrimSpace(short[:i])
+	}
+
+	// Graylog requires a short message
+	if short == "" && m.error != nil {
+		short = m.error.Error()
+	}
+	if short == "" {
+		short = "-"
+	}
+
+	fields = append(fields,
+		String("version", GELFVersion),
+		String("host", w.Host),
+		String("short_message", short),
+		Float64("timestamp", float64(m.when.UnixMilli())/1000),
+		Int("level", syslogSeverity(m.Level())),
+	)
+
+	if full := gelfFullMessage(msg, m); full != short {
+		fields = append(fields, String("full_message", full))
+	}
+
+	if m.verbosity > 0 {
+		fields = append(fields, Int("_verbosity", int(m.verbosity)))
+	}
+
+	if m.file != "" {
+		fields = append(fields, String("_pkg", m.pkg), String("_file", m.file), Int("_line", m.line))
+	}
+
+	if m.error != nil {
+		fields = append(fields, String("_error", m.error.Error()))
+		if errType := errorType(m.error); errType != "" {
+			fields = append(fields, String("_error_type", errType))
+		}
+	}
+
+	b = append(b, '{')
+
+	for i, f := range sortFields(fields) {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendJSONString(b, f.Key)
+		b = append(b, ':')
+		b = appendGELFField(b, f)
+	}
+
+	return append(b, '}')
+}
+
+// Combines the message, error, and stack trace into the GELF `full_message`.
+func gelfFullMessage(msg string, m Message) string {
+	var b strings.Builder
+	b.WriteString(msg)
+
+	if m.error != nil {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(m.error.Error())
+	}
+
+	if len(m.stack) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(stackTrace(m.stack))
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// Converts a field name to a GELF additional field name, e.g. `user.id` to `_user.id`.
+func gelfName(name string) string {
+	name = gelfInvalidName.ReplaceAllString(name, "_")
+
+	if name == "id" {
+		return "_id_"
+	}
+
+	return "_" + name
+}
+
+// GELF additional fields may only be strings or numbers.
+func appendGELFField(b []byte, f Field) []byte {
+	switch f.kind {
+	case intField, int64Field, float64Field:
+		return appendJSONField(b, f)
+	case objectField:
+		switch f.value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return appendJSONValue(b, f.value)
+		}
+	}
+
+	return appendJSONString(b, encodePlainField(f))
+}
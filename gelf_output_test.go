@@ -0,0 +1,307 @@
+package kleos_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// Listens for GELF messages over UDP, reassembling chunks and decompressing them.
+func listenGELFUDP(t *testing.T) (string, <-chan map[string]any) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	docs := make(chan map[string]any, 10)
+
+	go func() {
+		chunks := make(map[string][][]byte)
+
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			data := append([]byte(nil), buf[:n]...)
+
+			if data[0] == 0x1e && data[1] == 0x0f {
+				id := string(data[2:10])
+				if chunks[id] == nil {
+					chunks[id] = make([][]byte, data[11])
+				}
+				chunks[id][data[10]] = data[12:]
+
+				complete := true
+				for _, chunk := range chunks[id] {
+					complete = complete && chunk != nil
+				}
+				if !complete {
+					continue
+				}
+
+				data = bytes.Join(chunks[id], nil)
+				delete(chunks, id)
+			}
+
+			docs <- decodeGELF(t, data)
+		}
+	}()
+
+	return conn.LocalAddr().String(), docs
+}
+
+// Listens for null-delimited GELF messages over TCP.
+func listenGELFTCP(t *testing.T) (string, <-chan map[string]any) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	docs := make(chan map[string]any, 10)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			data, err := r.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			docs <- decodeGELF(t, data[:len(data)-1])
+		}
+	}()
+
+	return listener.Addr().String(), docs
+}
+
+// Decompresses and parses a GELF message, based on its magic bytes.
+func decodeGELF(t *testing.T, data []byte) map[string]any {
+	var r io.Reader = bytes.NewReader(data)
+
+	var err error
+	switch {
+	case data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(r)
+	case data[0] == 0x78:
+		r, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	var doc map[string]any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		t.Error(err)
+	}
+
+	return doc
+}
+
+// Waits for the next GELF message.
+func nextGELF(t *testing.T, docs <-chan map[string]any) map[string]any {
+	select {
+	case doc := <-docs:
+		return doc
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a GELF message")
+		return nil
+	}
+}
+
+func newGELFLogger(t *testing.T, network, addr string) (*kleos.Kleos, *kleos.GELFOutput) {
+	out, err := kleos.DialGELF(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = out.Close() })
+
+	out.Host = "test-host"
+
+	log := kleos.New()
+	log.SetOutput(out)
+
+	return log, out
+}
+
+func TestGELFMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, docs := listenGELFUDP(t)
+	log, _ := newGELFLogger(t, "udp", addr)
+
+	log.With(kleos.Fields{"user": "jdoe", "count": 3, "id": "abc", "bad key!": true}).
+		Error(errors.New("boom")).
+		Log("Request failed")
+
+	doc := nextGELF(t, docs)
+
+	assert.Equal("1.1", doc["version"])
+	assert.Equal("test-host", doc["host"])
+	assert.Equal("Request failed", doc["short_message"])
+	assert.Equal("Request failed\n\nboom", doc["full_message"])
+	assert.Equal(float64(3), doc["level"])
+	assert.InDelta(float64(time.Now().Unix()), doc["timestamp"], 5)
+	assert.Equal("jdoe", doc["_user"])
+	assert.Equal(float64(3), doc["_count"])
+	assert.Equal("abc", doc["_id_"])
+	assert.Equal("true", doc["_bad_key_"])
+	assert.Equal("boom", doc["_error"])
+	assert.Equal("*errors.errorString", doc["_error_type"])
+	assert.Equal("kleos", doc["_pkg"])
+	assert.Equal("gelf_output_test.go", doc["_file"])
+	assert.NotContains(doc, "_id")
+}
+
+func TestGELFLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, docs := listenGELFUDP(t)
+	log, _ := newGELFLogger(t, "udp", addr)
+	log.SetVerbosity(2)
+
+	log.V(2).Log("debug")
+	doc := nextGELF(t, docs)
+	assert.Equal(float64(7), doc["level"])
+	assert.Equal(float64(2), doc["_verbosity"])
+	assert.NotContains(doc, "full_message")
+
+	log.Info("info")
+	assert.Equal(float64(6), nextGELF(t, docs)["level"])
+
+	log.Warn().Log("warn")
+	assert.Equal(float64(4), nextGELF(t, docs)["level"])
+}
+
+func TestGELFMultiline(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, docs := listenGELFUDP(t)
+	log, _ := newGELFLogger(t, "udp", addr)
+
+	log.Log("Summary\nmore detail")
+
+	doc := nextGELF(t, docs)
+	assert.Equal("Summary", doc["short_message"])
+	assert.Equal("Summary\nmore detail", doc["full_message"])
+}
+
+func TestGELFChunkedCompression(t *testing.T) {
+	for name, compression := range map[string]kleos.GELFCompression{
+		"none": kleos.GELFUncompressed,
+		"gzip": kleos.GELFGzip,
+		"zlib": kleos.GELFZlib,
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			addr, docs := listenGELFUDP(t)
+			log, out := newGELFLogger(t, "udp", addr)
+			out.Compression = compression
+			out.ChunkSize = 100
+
+			// Random data so compression doesn't make it fit in one chunk
+			random := make([]byte, 200)
+			_, _ = rand.Read(random)
+			body := hex.EncodeToString(random)
+
+			log.With(kleos.Fields{"body": body}).Log("big")
+
+			doc := nextGELF(t, docs)
+			assert.Equal("big", doc["short_message"])
+			assert.Equal(body, doc["_body"])
+		})
+	}
+}
+
+func TestGELFTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// Returns the address the next packet came from
+	from := func() string {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		buf := make([]byte, 65536)
+		_, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return addr.String()
+	}
+
+	log, out := newGELFLogger(t, "udp", conn.LocalAddr().String())
+
+	log.Log("before")
+	before := from()
+
+	out.ChunkSize = 20
+	err = out.Write(kleos.New().With(kleos.Fields{"body": strings.Repeat("x", 2000)}))
+	assert.ErrorIs(err, kleos.ErrGELFTooLarge)
+
+	// The connection wasn't at fault, so it's kept
+	out.ChunkSize = 0
+	log.Log("after")
+	assert.Equal(before, from())
+}
+
+func TestGELFTCP(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, docs := listenGELFTCP(t)
+	log, out := newGELFLogger(t, "tcp", addr)
+
+	// Compression isn't supported over TCP, so it's ignored
+	out.Compression = kleos.GELFGzip
+
+	log.Log("first")
+	log.Log("second")
+
+	assert.Equal("first", nextGELF(t, docs)["short_message"])
+	assert.Equal("second", nextGELF(t, docs)["short_message"])
+}
+
+func TestGELFClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, docs := listenGELFTCP(t)
+	log, out := newGELFLogger(t, "tcp", addr)
+
+	log.Log("first")
+	assert.Equal("first", nextGELF(t, docs)["short_message"])
+
+	assert.NoError(out.Close())
+
+	// Doesn't reconnect after closing
+	assert.ErrorIs(out.Write(kleos.Message{}), kleos.ErrWriterClosed)
+	assert.NoError(out.Close())
+}
@@ -1,6 +1,6 @@
 module github.com/sbowman/kleos
 
-go 1.18
+go 1.20
 
 require (
 	github.com/fatih/color v1.17.0
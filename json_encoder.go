@@ -0,0 +1,302 @@
+package kleos
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Buffers larger than this aren't returned to the pool, so one huge message doesn't pin the
+// memory.
+const maxPooledBuffer = 64 * 1024
+
+// Reusable buffers for encoding JSON messages.
+var jsonBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// Gets an empty buffer from the pool.
+func getJSONBuffer() *[]byte {
+	b := jsonBuffers.Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+// Returns the buffer to the pool, unless it's grown too large.
+func putJSONBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+
+	jsonBuffers.Put(b)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// Appends the string as a JSON string, escaping it the same way encoding/json does, including
+// the HTML characters <, >, and &.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c < utf8.RuneSelf {
+			if jsonSafe(c) {
+				i++
+				continue
+			}
+
+			b = append(b, s[start:i]...)
+
+			switch c {
+			case '\\', '"':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+
+		// Valid JSON, but breaks JavaScript
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+
+		i += size
+	}
+
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// Can the ASCII character be included in a JSON string as is?
+func jsonSafe(c byte) bool {
+	return c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&'
+}
+
+// Appends the float the same way encoding/json does.  NaN and infinity aren't valid JSON, so
+// they're appended as strings.
+func appendJSONFloat(b []byte, f float64, bits int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return appendJSONString(b, strconv.FormatFloat(f, 'g', -1, bits))
+	}
+
+	// Like ES6, use exponents only for very small or very large numbers
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+
+	// Clean up e-09 to e-9
+	if format == 'e' {
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+
+	return b
+}
+
+// Appends the UUID as a JSON string, e.g. "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+func appendJSONUUID(b []byte, id uuid.UUID) []byte {
+	b = append(b, '"')
+
+	for i, c := range id {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			b = append(b, '-')
+		}
+		b = append(b, hexDigits[c>>4], hexDigits[c&0xf])
+	}
+
+	return append(b, '"')
+}
+
+// Appends a field value as JSON.  The common types are appended directly; anything else is
+// marshaled with encoding/json.  Errors and fmt.Stringers are appended as strings, unless they
+// marshal themselves to JSON.  Durations remain nanoseconds, as encoding/json outputs them.
+func appendJSONValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...)
+	case string:
+		return appendJSONString(b, v)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case float32:
+		return appendJSONFloat(b, float64(v), 32)
+	case float64:
+		return appendJSONFloat(b, v, 64)
+	case uuid.UUID:
+		return appendJSONUUID(b, v)
+	case time.Duration:
+		return strconv.AppendInt(b, int64(v), 10)
+	case time.Time:
+		b = append(b, '"')
+		b = v.AppendFormat(b, time.RFC3339Nano)
+		return append(b, '"')
+	case []ErrorLink:
+		return appendJSONChain(b, v)
+	case []Frame:
+		return appendJSONStack(b, v)
+	case json.Marshaler, encoding.TextMarshaler:
+		return appendJSONMarshal(b, value)
+	case error:
+		if nilPointer(value) {
+			return append(b, "null"...)
+		}
+		return appendJSONString(b, v.Error())
+	case fmt.Stringer:
+		if nilPointer(value) {
+			return append(b, "null"...)
+		}
+		return appendJSONString(b, v.String())
+	}
+
+	return appendJSONMarshal(b, value)
+}
+
+// Appends a typed field's value as JSON, without boxing it.
+func appendJSONField(b []byte, f Field) []byte {
+	switch f.kind {
+	case stringField:
+		return appendJSONString(b, f.str)
+	case intField, int64Field, durationField:
+		return strconv.AppendInt(b, f.num, 10)
+	case float64Field:
+		return appendJSONFloat(b, f.float(), 64)
+	case boolField:
+		return strconv.AppendBool(b, f.num == 1)
+	case timeField:
+		b = append(b, '"')
+		b = f.time().AppendFormat(b, time.RFC3339Nano)
+		return append(b, '"')
+	case uuidField:
+		return appendJSONUUID(b, f.uuid())
+	}
+
+	return appendJSONValue(b, f.value)
+}
+
+// Appends the value marshaled by encoding/json.  If the value can't be marshaled, e.g. a
+// channel, appends it formatted as a string instead.
+func appendJSONMarshal(b []byte, value interface{}) []byte {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return appendJSONString(b, fmt.Sprintf("%v", value))
+	}
+
+	return append(b, encoded...)
+}
+
+// Appends an error chain as an array of `msg` and `type` objects.
+func appendJSONChain(b []byte, chain []ErrorLink) []byte {
+	b = append(b, '[')
+
+	for i, link := range chain {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = append(b, `{"msg":`...)
+		b = appendJSONString(b, link.Msg)
+		b = append(b, `,"type":`...)
+		b = appendJSONString(b, link.Type)
+		b = append(b, '}')
+	}
+
+	return append(b, ']')
+}
+
+// Appends a stack trace as an array of `func`, `file`, and `line` objects.
+func appendJSONStack(b []byte, stack []Frame) []byte {
+	b = append(b, '[')
+
+	for i, frame := range stack {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = append(b, `{"func":`...)
+		b = appendJSONString(b, frame.Func)
+		b = append(b, `,"file":`...)
+		b = appendJSONString(b, frame.File)
+		b = append(b, `,"line":`...)
+		b = strconv.AppendInt(b, int64(frame.Line), 10)
+		b = append(b, '}')
+	}
+
+	return append(b, ']')
+}
+
+// Is the value a nil pointer?  Calling Error or String on one may panic.
+func nilPointer(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
@@ -1,8 +1,9 @@
 package kleos
 
 import (
-	"encoding/json"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -17,76 +18,415 @@ const (
 	JSONSrc       = "src"
 	JSONLine      = "line"
 	JSONError     = "err"
+	JSONErrorType = "err_type"
+	JSONChain     = "err_chain"
+	JSONStack     = "stack"
 )
 
-// JSONOutput outputs in JSON format.  Meant for services like ELK or Splunk. Note that JSONOutput
-// will overload these properties:
+// JSONSchema configures the keys of the standard log data in the JSONOutput.  Leave a key empty
+// to leave that data out of the output.  Start with one of the presets, such as
+// DefaultJSONSchema or GCPJSONSchema, and adjust it as needed.
+type JSONSchema struct {
+	Timestamp string // when the message was generated
+	Message   string // the plaintext log message
+	Level     string // the log level, e.g. debug, info, error
+	Verbosity string // the verbosity of the debug message, when relevant
+	Pkg       string // the package in which this log message was generated
+	Src       string // the source file in which this log message was generated
+	Line      string // the source code line number that contains this log message
+	Error     string // the error message formatted, if present
+	ErrorType string // the Go type of the error, if present
+	Chain     string // the errors wrapped by the error, if any
+	Stack     string // the stack trace of an error message, if enabled
+
+	// Fields nests the custom fields in an object under this key, so they can't collide with
+	// the standard keys.  If empty, the custom fields are output alongside the standard keys,
+	// and the standard keys win.
+	Fields string
+
+	// Levels renames the log levels, e.g. "WARNING" rather than "warn".  Levels that aren't
+	// in the map are output as is; see Level.String.
+	Levels map[Level]string
+}
+
+// DefaultJSONSchema is the schema the JSONOutput uses unless configured otherwise.
+var DefaultJSONSchema = JSONSchema{
+	Timestamp: JSONTimestamp,
+	Message:   JSONMessage,
+	Level:     JSONLevel,
+	Verbosity: JSONVerbosity,
+	Pkg:       JSONPkg,
+	Src:       JSONSrc,
+	Line:      JSONLine,
+	Error:     JSONError,
+	ErrorType: JSONErrorType,
+	Chain:     JSONChain,
+	Stack:     JSONStack,
+}
+
+// LogstashJSONSchema uses the Elastic Common Schema (ECS) names for the standard keys, for
+// shipping logs to Elasticsearch with Logstash.  Elasticsearch expands the dotted names into
+// objects.  For a complete ECS document, see ECSOutput.
+var LogstashJSONSchema = JSONSchema{
+	Timestamp: ECSTimestamp,
+	Message:   ECSMessage,
+	Level:     ECSLevel,
+	Verbosity: ECSVerbosity,
+	Pkg:       ECSLogger,
+	Src:       ECSFile,
+	Line:      ECSLine,
+	Error:     ECSError,
+	ErrorType: ECSErrorType,
+	Chain:     "error.chain",
+	Stack:     "error.stack",
+}
+
+// DatadogJSONSchema uses the Datadog standard attributes for the standard keys, so Datadog
+// picks up the timestamp, status, and error details without a custom pipeline.
+var DatadogJSONSchema = JSONSchema{
+	Timestamp: "timestamp",
+	Message:   "message",
+	Level:     "status",
+	Verbosity: "verbosity",
+	Pkg:       "logger.name",
+	Src:       "logger.file",
+	Line:      "logger.line",
+	Error:     "error.message",
+	ErrorType: "error.kind",
+	Chain:     "error.chain",
+	Stack:     "error.stack",
+}
+
+// GCPJSONSchema uses the special fields of Google Cloud Logging's structured logging, so
+// the logging agent picks up the time, severity, and message.  The custom fields are
+// output as the log entry's JSON payload.
+var GCPJSONSchema = JSONSchema{
+	Timestamp: "time",
+	Message:   "message",
+	Level:     "severity",
+	Verbosity: "verbosity",
+	Pkg:       "pkg",
+	Src:       "src",
+	Line:      "line",
+	Error:     "error",
+	ErrorType: "error_type",
+	Chain:     "error_chain",
+	Stack:     "stack",
+	Levels: map[Level]string{
+		DebugLevel: "DEBUG",
+		InfoLevel:  "INFO",
+		WarnLevel:  "WARNING",
+		ErrorLevel: "ERROR",
+		FatalLevel: "CRITICAL",
+	},
+}
+
+// LokiJSONSchema uses keys that are valid Loki label names, so the keys extracted by LogQL's
+// json parser don't need renaming.  Loki detects the level from the `level` key.
+var LokiJSONSchema = JSONSchema{
+	Timestamp: "ts",
+	Message:   "msg",
+	Level:     "level",
+	Verbosity: "verbosity",
+	Pkg:       "pkg",
+	Src:       "src",
+	Line:      "line",
+	Error:     "error",
+	ErrorType: "error_type",
+	Chain:     "error_chain",
+	Stack:     "stack",
+}
+
+// JSONOutput outputs in JSON format.  Meant for services like ELK or Splunk.  Each message is
+// output as a JSON object on a single line, with the keys sorted.  By default, JSONOutput
+// overloads these properties:
 //
 // * `ts` - when the message was generated
-// * `host` - the hostname
-// * `message`   - the plaintext log message
+// * `msg` - the plaintext log message
 // * `level` - the log level, e.g. debug, info, error
-// * `verbosity` - the verbosity of the debug message, when relevant
-// * `pkg`   - the package in which this log message was generated
-// * `src`   - the source file in which this log message was generated
-// * `line`  - the source code line number that contains this log message
-// * `error` - the error message formatted, if present
+// * `v` - the verbosity of the debug message, when relevant
+// * `pkg` - the package in which this log message was generated
+// * `src` - the source file in which this log message was generated
+// * `line` - the source code line number that contains this log message
+// * `err` - the error message formatted, if present
+// * `err_type` - the Go type of the error, if present
+// * `err_chain` - the errors wrapped by the error, if any, as an array of `msg` and `type`
+// objects, starting with the error itself
+// * `stack` - the stack trace of an error message, if enabled, as an array of `func`, `file`,
+// and `line` objects
+//
+// Change the keys with the JSONSchema, e.g. `out.Timestamp = "@timestamp"`, or use one of
+// the presets, e.g. `out.JSONSchema = kleos.GCPJSONSchema`.  Configure the output before
+// logging with it.
 type JSONOutput struct {
 	sync.Mutex
-	out     io.Writer
-	encoder *json.Encoder
+	JSONSchema
+
+	out io.Writer
 }
 
-// NewJSONOutput creates a new log output that's meant to be used with the ELK stack.  Supports ECS
-// fields for the standard fields.  See JSONOutput for details.
+// NewJSONOutput creates a new log output that's meant to be used with the ELK stack.  Uses the
+// DefaultJSONSchema.  See JSONOutput for details.
 func NewJSONOutput(writer io.Writer) *JSONOutput {
 	return &JSONOutput{
-		out:     writer,
-		encoder: json.NewEncoder(writer),
+		JSONSchema: DefaultJSONSchema,
+		out:        writer,
 	}
 }
 
+// Write the message as a single line of JSON, with the keys sorted.  The output matches
+// encoding/json's, but the common field types are encoded without reflection, into a pooled
+// buffer.
 func (w *JSONOutput) Write(m Message) error {
-	if m.fields == nil {
-		m.fields = make(Fields)
+	buf := getJSONBuffer()
+	defer putJSONBuffer(buf)
+
+	*buf = w.JSONSchema.appendMessage(*buf, m)
+
+	w.Lock()
+	defer w.Unlock()
+
+	if _, err := w.out.Write(*buf); err != nil {
+		return err
 	}
 
-	m.fields[JSONTimestamp] = m.when.UTC().Format(PaddedRFC3339Ms)
+	return nil
+}
+
+// The standard log data output by the JSONOutput.
+type jsonData uint8
+
+const (
+	jsonTimestamp jsonData = iota
+	jsonMessage
+	jsonLevel
+	jsonVerbosity
+	jsonPkg
+	jsonSrc
+	jsonLine
+	jsonError
+	jsonErrorType
+	jsonChain
+	jsonStack
+	jsonFields
+)
+
+// A standard key and the data it holds.
+type jsonKey struct {
+	key  string
+	data jsonData
+}
+
+// Appends the message as a JSON object followed by a newline.  The standard keys replace any
+// custom fields of the same name.
+func (s JSONSchema) appendMessage(b []byte, m Message) []byte {
+	fields := m.untypedFields()
+
+	msg := strings.TrimSpace(m.msg)
+
+	var chain []ErrorLink
+	var errType string
+	if m.error != nil {
+		errType = errorType(m.error)
+
+		if s.Chain != "" {
+			chain = m.ErrorChain()
+		}
+	}
+
+	// The standard keys with something to output, in order of precedence
+	var stdArr [12]jsonKey
+	std := stdArr[:0]
+
+	addKey := func(key string, data jsonData) {
+		if key != "" {
+			std = append(std, jsonKey{key, data})
+		}
+	}
+
+	addKey(s.Timestamp, jsonTimestamp)
+	addKey(s.Level, jsonLevel)
 
 	if m.verbosity > 0 {
-		m.fields[JSONLevel] = "debug"
-		m.fields[JSONVerbosity] = m.verbosity
-	} else if m.error == nil {
-		m.fields[JSONLevel] = "info"
-	} else {
-		m.fields[JSONLevel] = "error"
+		addKey(s.Verbosity, jsonVerbosity)
 	}
 
-	// Write out the human-readable message
-	msg := strings.TrimSpace(m.msg)
 	if msg != "" {
-		m.fields[JSONMessage] = msg
+		addKey(s.Message, jsonMessage)
 	}
 
 	if m.file != "" {
-		m.fields[JSONPkg] = m.pkg
-		m.fields[JSONSrc] = m.file
-		m.fields[JSONLine] = m.line
+		addKey(s.Pkg, jsonPkg)
+		addKey(s.Src, jsonSrc)
+		addKey(s.Line, jsonLine)
 	}
 
 	if m.error != nil {
-		m.fields[JSONError] = m.error.Error()
+		addKey(s.Error, jsonError)
+
+		if errType != "" {
+			addKey(s.ErrorType, jsonErrorType)
+		}
+
+		if len(chain) > 1 {
+			addKey(s.Chain, jsonChain)
+		}
 	}
 
-	// Applies any registered context variables to the fields
-	contexts.Run(m.ctx, m.fields)
+	if len(m.stack) > 0 {
+		addKey(s.Stack, jsonStack)
+	}
 
-	w.Lock()
-	defer w.Unlock()
+	if s.Fields != "" && (len(fields) > 0 || len(m.typed) > 0) {
+		addKey(s.Fields, jsonFields)
+	}
 
-	if err := w.encoder.Encode(m.fields); err != nil {
-		return err
+	var arr [32]string
+	keys := arr[:0]
+
+	for _, k := range std {
+		keys = append(keys, k.key)
 	}
 
-	return nil
+	if s.Fields == "" {
+		keys = appendFieldKeys(keys, fields, m.typed)
+	}
+
+	keys = uniqueKeys(keys)
+
+	b = append(b, '{')
+
+	for i, key := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendJSONString(b, key)
+		b = append(b, ':')
+
+		data, ok := standardKey(std, key)
+		if !ok {
+			b = appendFieldValue(b, key, fields, m.typed)
+			continue
+		}
+
+		switch data {
+		case jsonTimestamp:
+			b = append(b, '"')
+			b = m.when.UTC().AppendFormat(b, PaddedRFC3339Ms)
+			b = append(b, '"')
+		case jsonLevel:
+			b = appendJSONString(b, s.levelName(m.Level()))
+		case jsonVerbosity:
+			b = strconv.AppendUint(b, uint64(m.verbosity), 10)
+		case jsonMessage:
+			b = appendJSONString(b, msg)
+		case jsonPkg:
+			b = appendJSONString(b, m.pkg)
+		case jsonSrc:
+			b = appendJSONString(b, m.file)
+		case jsonLine:
+			b = strconv.AppendInt(b, int64(m.line), 10)
+		case jsonError:
+			b = appendJSONString(b, m.error.Error())
+		case jsonErrorType:
+			b = appendJSONString(b, errType)
+		case jsonChain:
+			b = appendJSONChain(b, chain)
+		case jsonStack:
+			b = appendJSONStack(b, m.stack)
+		case jsonFields:
+			b = appendJSONFields(b, fields, m.typed)
+		}
+	}
+
+	return append(b, '}', '\n')
+}
+
+// Returns the name of the level to output.
+func (s JSONSchema) levelName(level Level) string {
+	if name, ok := s.Levels[level]; ok {
+		return name
+	}
+
+	return level.String()
+}
+
+// Finds the data held by a standard key.  If more than one standard key has the same name,
+// the first one wins.
+func standardKey(std []jsonKey, key string) (jsonData, bool) {
+	for _, k := range std {
+		if k.key == key {
+			return k.data, true
+		}
+	}
+
+	return 0, false
+}
+
+// Appends the keys of the custom fields and typed fields.
+func appendFieldKeys(keys []string, fields Fields, typed []Field) []string {
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	for _, f := range typed {
+		keys = append(keys, f.Key)
+	}
+
+	return keys
+}
+
+// Appends the value of a custom field.  Typed fields take precedence.
+func appendFieldValue(b []byte, key string, fields Fields, typed []Field) []byte {
+	if f, ok := findField(typed, key); ok {
+		return appendJSONField(b, f)
+	}
+
+	return appendJSONValue(b, fields[key])
+}
+
+// Sorts the keys and removes any repeats, in place.  A handful of keys are sorted without
+// sort.Strings, which would move them to the heap.
+func uniqueKeys(keys []string) []string {
+	if len(keys) > 32 {
+		sort.Strings(keys)
+	} else {
+		for i := 1; i < len(keys); i++ {
+			for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+				keys[j], keys[j-1] = keys[j-1], keys[j]
+			}
+		}
+	}
+
+	unique := keys[:0]
+	for _, k := range keys {
+		if len(unique) == 0 || k != unique[len(unique)-1] {
+			unique = append(unique, k)
+		}
+	}
+
+	return unique
+}
+
+// Appends the custom fields as a JSON object, with the keys sorted.
+func appendJSONFields(b []byte, fields Fields, typed []Field) []byte {
+	var arr [32]string
+	keys := appendFieldKeys(arr[:0], fields, typed)
+
+	keys = uniqueKeys(keys)
+
+	b = append(b, '{')
+
+	for i, key := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		b = appendJSONString(b, key)
+		b = append(b, ':')
+		b = appendFieldValue(b, key, fields, typed)
+	}
+
+	return append(b, '}')
 }
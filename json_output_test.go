@@ -0,0 +1,325 @@
+package kleos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// The original JSONOutput, which encodes the fields map with encoding/json.  The JSONOutput
+// must match its output, and it's the baseline for the benchmarks.
+type mapJSONOutput struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+func newMapJSONOutput(writer io.Writer) *mapJSONOutput {
+	return &mapJSONOutput{encoder: json.NewEncoder(writer)}
+}
+
+func (w *mapJSONOutput) Write(m kleos.Message) error {
+	fields := m.Fields()
+
+	fields[kleos.JSONTimestamp] = m.Time().UTC().Format(kleos.PaddedRFC3339Ms)
+
+	fields[kleos.JSONLevel] = m.Level().String()
+	if m.Verbosity() > 0 {
+		fields[kleos.JSONVerbosity] = m.Verbosity()
+	}
+
+	if msg := strings.TrimSpace(m.Text()); msg != "" {
+		fields[kleos.JSONMessage] = msg
+	}
+
+	if m.File() != "" {
+		fields[kleos.JSONPkg] = m.Package()
+		fields[kleos.JSONSrc] = m.File()
+		fields[kleos.JSONLine] = m.Line()
+	}
+
+	if err := m.Err(); err != nil {
+		fields[kleos.JSONError] = err.Error()
+		fields[kleos.JSONErrorType] = reflect.TypeOf(err).String()
+
+		if chain := m.ErrorChain(); len(chain) > 1 {
+			fields[kleos.JSONChain] = chain
+		}
+	}
+
+	if stack := m.Stack(); len(stack) > 0 {
+		fields[kleos.JSONStack] = stack
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	return w.encoder.Encode(fields)
+}
+
+type jsonPoint struct {
+	X, Y int
+}
+
+func TestJSONOutputMatchesEncodingJSON(t *testing.T) {
+	var got, want bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.Tee(kleos.NewJSONOutput(&got), newMapJSONOutput(&want)))
+	log.SetVerbosity(4)
+	log.SetStackDepth(3)
+
+	id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	when := time.Date(2024, 3, 9, 17, 4, 5, 120000000, time.FixedZone("EST", -5*3600))
+	wrapped := fmt.Errorf("unable to save <user>: %w", errors.New("connection reset"))
+
+	tests := []struct {
+		comment string
+		log     func()
+	}{
+		{"message", func() { log.Log("Hello World") }},
+		{"debug", func() { log.V(3).Log("  Hello World\n") }},
+		{"warning", func() { log.Warn().Log("Running low") }},
+		{"no message", func() { log.Log("") }},
+		{"escaping", func() {
+			log.Log("\"quotes\" \\ <tags> & \t\n\r \x00\x1f\x7f café    \xff 日本")
+		}},
+		{"strings", func() {
+			log.With(kleos.Fields{"name": "NBC Sports", "html": "<a href=\"x\">&</a>", "empty": ""}).Log("Hello")
+		}},
+		{"numbers", func() {
+			log.With(kleos.Fields{
+				"int": -42, "int8": int8(-8), "int16": int16(16), "int32": int32(-32), "int64": int64(math.MaxInt64),
+				"uint": uint(42), "uint8": uint8(8), "uint16": uint16(16), "uint32": uint32(32), "uint64": uint64(math.MaxUint64),
+			}).Log("Numbers")
+		}},
+		{"floats", func() {
+			log.With(kleos.Fields{
+				"zero": 0.0, "neg": -0.5, "whole": 97.0, "small": 1e-7, "tiny": 1.5e-300, "big": 1e21, "huge": 1.7e308,
+				"f32": float32(3.14), "f32small": float32(1e-7), "f32big": float32(1e22),
+			}).Log("Floats")
+		}},
+		{"types", func() {
+			log.With(kleos.Fields{
+				"ok": true, "nope": false, "nil": nil, "id": id, "blank": uuid.UUID{}, "when": when,
+				"map": map[string]interface{}{"b": 1, "a": "<x>"}, "slice": []int{1, 2, 3}, "point": jsonPoint{1, 2},
+				"raw": json.RawMessage(`{"z": 1}`), "ip": net.ParseIP("10.0.0.1"), "duration": time.Second,
+			}).Log("Types")
+		}},
+		{"standard keys win", func() {
+			log.With(kleos.Fields{"msg": "overridden", "level": "overridden", "v": "kept", "err": "kept"}).Log("Hello")
+		}},
+		{"error", func() { log.Error(errors.New("yikes")).Log("Unable to save") }},
+		{"error chain", func() { log.Error(wrapped).Log("Unable to save") }},
+		{"bound fields", func() { log.Named("billing").With(kleos.Fields{"count": 3}).Log("Charged") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			got.Reset()
+			want.Reset()
+
+			test.log()
+
+			assert.Equal(t, want.String(), got.String())
+		})
+	}
+
+	log.EnableSource(false)
+	got.Reset()
+	want.Reset()
+
+	log.Log("No source")
+	assert.Equal(t, want.String(), got.String())
+}
+
+type jsonStringer struct {
+	name string
+}
+
+func (s *jsonStringer) String() string {
+	return "stringer " + s.name
+}
+
+func TestJSONOutputValues(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(&out))
+
+	var missing *jsonStringer
+
+	log.With(kleos.Fields{
+		"cause":    errors.New("connection reset"),
+		"stringer": &jsonStringer{"db"},
+		"missing":  missing,
+		"nan":      math.NaN(),
+		"inf":      math.Inf(-1),
+		"ch":       make(chan int),
+	}).Log("Values")
+
+	var fields map[string]interface{}
+	if !assert.NoError(json.Unmarshal(out.Bytes(), &fields)) {
+		return
+	}
+
+	// Errors and fmt.Stringers are output as strings, rather than as objects
+	assert.Equal("connection reset", fields["cause"])
+	assert.Equal("stringer db", fields["stringer"])
+	assert.Nil(fields["missing"])
+
+	// Values encoding/json rejects don't drop the message
+	assert.Equal("NaN", fields["nan"])
+	assert.Equal("-Inf", fields["inf"])
+	assert.Contains(fields["ch"], "0x")
+}
+
+func TestJSONSchema(t *testing.T) {
+	tests := []struct {
+		comment string
+		schema  func(out *kleos.JSONOutput)
+		log     func(log *kleos.Kleos)
+		want    map[string]interface{}
+		missing []string
+	}{
+		{
+			comment: "renamed keys",
+			schema:  func(out *kleos.JSONOutput) { out.Timestamp = "@timestamp" },
+			log:     func(log *kleos.Kleos) { log.Log("Hello World") },
+			want:    map[string]interface{}{"msg": "Hello World", "level": "info"},
+			missing: []string{"ts"},
+		},
+		{
+			comment: "omitted keys",
+			schema:  func(out *kleos.JSONOutput) { out.Pkg, out.Src, out.Line = "", "", "" },
+			log:     func(log *kleos.Kleos) { log.Log("Hello World") },
+			missing: []string{"pkg", "src", "line", ""},
+		},
+		{
+			comment: "gcp",
+			schema:  func(out *kleos.JSONOutput) { out.JSONSchema = kleos.GCPJSONSchema },
+			log:     func(log *kleos.Kleos) { log.Warn().Log("Running low") },
+			want:    map[string]interface{}{"message": "Running low", "severity": "WARNING"},
+			missing: []string{"msg", "level"},
+		},
+		{
+			comment: "datadog",
+			schema:  func(out *kleos.JSONOutput) { out.JSONSchema = kleos.DatadogJSONSchema },
+			log:     func(log *kleos.Kleos) { log.Error(errors.New("yikes")).Log("Unable to save") },
+			want: map[string]interface{}{
+				"message": "Unable to save", "status": "error",
+				"error.message": "yikes", "error.kind": "*errors.errorString",
+			},
+		},
+		{
+			comment: "logstash",
+			schema:  func(out *kleos.JSONOutput) { out.JSONSchema = kleos.LogstashJSONSchema },
+			log:     func(log *kleos.Kleos) { log.V(2).Log("Hello World") },
+			want:    map[string]interface{}{"message": "Hello World", "log.level": "debug", "kleos.verbosity": 2.0},
+		},
+		{
+			comment: "loki",
+			schema:  func(out *kleos.JSONOutput) { out.JSONSchema = kleos.LokiJSONSchema },
+			log:     func(log *kleos.Kleos) { log.Error(errors.New("yikes")).Log("Unable to save") },
+			want:    map[string]interface{}{"msg": "Unable to save", "level": "error", "error": "yikes"},
+		},
+		{
+			comment: "standard keys win",
+			schema:  func(out *kleos.JSONOutput) {},
+			log: func(log *kleos.Kleos) {
+				log.With(kleos.Fields{"msg": "overridden"}).Add(kleos.String("level", "overridden")).Log("Hello World")
+			},
+			want: map[string]interface{}{"msg": "Hello World", "level": "info"},
+		},
+		{
+			comment: "nested fields",
+			schema:  func(out *kleos.JSONOutput) { out.Fields = "fields" },
+			log: func(log *kleos.Kleos) {
+				log.Named("billing").With(kleos.Fields{"msg": "kept"}).Add(kleos.Int("rows", 3)).Log("Hello World")
+			},
+			want: map[string]interface{}{
+				"msg":    "Hello World",
+				"fields": map[string]interface{}{"msg": "kept", "rows": 3.0, "logger": "billing"},
+			},
+			missing: []string{"rows", "logger"},
+		},
+		{
+			comment: "no nested fields",
+			schema:  func(out *kleos.JSONOutput) { out.Fields = "fields" },
+			log:     func(log *kleos.Kleos) { log.Log("Hello World") },
+			missing: []string{"fields"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			out := kleos.NewJSONOutput(&buf)
+			test.schema(out)
+
+			log := kleos.New()
+			log.SetOutput(out)
+			log.SetVerbosity(4)
+
+			test.log(log)
+
+			var doc map[string]interface{}
+			if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc), buf.String()) {
+				return
+			}
+
+			for key, value := range test.want {
+				assert.Equal(t, value, doc[key], key)
+			}
+
+			for _, key := range test.missing {
+				assert.NotContains(t, doc, key)
+			}
+		})
+	}
+}
+
+func benchmarkJSONOutput(b *testing.B, out kleos.Writer) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(out)
+	log.SetVerbosity(1)
+
+	id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	err := fmt.Errorf("unable to connect: %w", errors.New("connection reset"))
+
+	for n := 0; n < b.N; n++ {
+		log.V(1).Error(err).With(kleos.Fields{
+			"id":      id,
+			"name":    "NBC Sports",
+			"health":  97,
+			"latency": 12.5,
+			"healthy": false,
+			"checked": time.Time{},
+		}).Log("Database is having serious issues related to connections")
+	}
+}
+
+func BenchmarkJSONOutput(b *testing.B) {
+	benchmarkJSONOutput(b, kleos.NewJSONOutput(io.Discard))
+}
+
+func BenchmarkJSONOutputEncodingJSON(b *testing.B) {
+	benchmarkJSONOutput(b, newMapJSONOutput(io.Discard))
+}
@@ -9,21 +9,39 @@ import (
 	"sync"
 )
 
+// LoggerField is the field holding the name of a logger created with Named.
+const LoggerField = "logger"
+
 // Used for our "global" logger.
 var local = New()
 
 // Kleos represents a logger.  There's an internal logger instance that's created and used
 // for the global functions such as `Log` or `With`, though you may create your own Kleos
 // instance if you like.
+//
+// Loggers derived from another logger with Named or Bind share the output, verbosity,
+// source, and context settings of the logger they were derived from, but add their own fields
+// to every message.
 type Kleos struct {
 	sync.RWMutex
 
 	output        Writer
 	includeSource bool
+	verbosity     uint8
+	stackDepth    int
+	contexts      contextFuncs
+	sampler       *Sampler
+	vmodule       *vmodule
+	redactor      *Redactor
+
+	parent *Kleos // the logger holding the settings, if this logger was derived from another
+	fields Fields // fields bound to every message; never modified once set
 }
 
 // New creates a new logging instance.  Typically there's no need to do this unless you're
-// being strict about no global variables.
+// being strict about no global variables.  Each instance carries its own output, verbosity,
+// source settings, and context functions, so changes to one instance don't affect another
+// (including the global logger).
 func New() *Kleos {
 	return &Kleos{
 		output:        NewTextOutput(os.Stdout),
@@ -34,10 +52,12 @@ func New() *Kleos {
 // EnableSource enables or disables reporting the source file and line number of the log
 // message.
 func (k *Kleos) EnableSource(enabled bool) {
-	k.Lock()
-	defer k.Unlock()
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
 
-	k.includeSource = enabled
+	root.includeSource = enabled
 }
 
 // EnableSource enables or disables reporting the source file and line number of the log
@@ -49,40 +69,88 @@ func EnableSource(enabled bool) {
 // Context records the context so that values stored in the context can be applied to the
 // fields automatically on output.
 func (k *Kleos) Context(ctx context.Context) Message {
-	return generate(k.output, k.includeSource).Context(ctx)
+	return generate(k, 0).Context(ctx)
 }
 
 // V applies a verbosity level to a debug message.
 func (k *Kleos) V(verbosity uint8) Message {
-	return generate(k.output, k.includeSource).V(verbosity)
+	return generate(k, verbosity)
 }
 
 // Error adds the error message as a field, "source", in the output.
 func (k *Kleos) Error(err error) Message {
-	return generate(k.output, k.includeSource).Error(err)
+	return generate(k, 0).Error(err)
 }
 
 // With applies the given fields to the log message.
 func (k *Kleos) With(fields Fields) Message {
-	return generate(k.output, k.includeSource).With(fields)
+	return generate(k, 0).With(fields)
+}
+
+// Add applies the typed fields to the log message.  See Message.Add.
+func (k *Kleos) Add(fields ...Field) Message {
+	return generate(k, 0).Add(fields...)
 }
 
-// WithFields applies the given fields to the log message (deprecated).
+// WithFields applies the given fields to the log message.
+//
+// Deprecated: use With, or Bind to add the fields to every message.
 func (k *Kleos) WithFields(fields Fields) Message {
-	return generate(k.output, k.includeSource).With(fields)
+	return generate(k, 0).With(fields)
+}
+
+// Bind creates a logger that adds the given fields to every message it logs, along with any
+// fields already bound to this logger.  The new logger shares this logger's settings.
+//
+// When the same field is set in more than one place, fields passed to With take precedence
+// over bound fields, which take precedence over values from the context.
+func (k *Kleos) Bind(fields Fields) *Kleos {
+	bound := make(Fields, len(k.fields)+len(fields))
+	for key, value := range k.fields {
+		bound[key] = value
+	}
+
+	for key, value := range fields {
+		bound[key] = value
+	}
+
+	return &Kleos{
+		parent: k.base(),
+		fields: bound,
+	}
+}
+
+// Named creates a logger that adds its name to every message it logs as the "logger" field.
+// Naming a named logger appends the new name with a dot, e.g. "billing.db".  The new logger
+// shares this logger's settings.
+func (k *Kleos) Named(name string) *Kleos {
+	if parent, ok := k.fields[LoggerField].(string); ok && parent != "" {
+		name = parent + "." + name
+	}
+
+	return k.Bind(Fields{LoggerField: name})
+}
+
+// Returns the logger holding the settings for this logger.
+func (k *Kleos) base() *Kleos {
+	if k.parent != nil {
+		return k.parent
+	}
+
+	return k
 }
 
 // Source overrides the package, file, and line number of the log message.  Helpful for
 // middleware.
 func (k *Kleos) Source(back int) Message {
-	return generate(k.output, k.includeSource).Source(back)
+	return generate(k, 0).Source(back)
 }
 
 // Debug generates a debug message.  Equivalent to `kleos.V(1).Log("This is a debug
 // messsage!")`.  If the Kleos verbosity is lower than the verbosity of the message, the
 // message will not be output.  Should use `V().Log()` instead.
 func (k *Kleos) Debug(msg string) {
-	generate(k.output, k.includeSource).Debug(msg)
+	generate(k, 1).Debug(msg)
 }
 
 // Log logs a message.  If the message has verbosity, it is logged as a debug message (or
@@ -90,56 +158,84 @@ func (k *Kleos) Debug(msg string) {
 // but has errors, it is logged as an error message.  If it has no verbosity and no
 // errors, it is logged as an info message.
 func (k *Kleos) Log(msg string) {
-	generate(k.output, k.includeSource).Log(msg)
+	generate(k, 0).Log(msg)
 }
 
 // Info logs a message.  Deprecated; use Log instead.
 func (k *Kleos) Info(msg string) {
-	generate(k.output, k.includeSource).Log(msg)
+	generate(k, 0).Log(msg)
 }
 
-// TODO: create a Logger struct and use that for the global logger.
-// TODO: put the mutex in the logger
+// Warn marks the log message as a warning, for problems that aren't errors, such as a
+// degraded service.
+func (k *Kleos) Warn() Message {
+	return generate(k, 0).Warn()
+}
 
-const pkgoffset = 1
+// Fatal logs a fatal message, flushes the output, and exits the program with a status of 1.
+func (k *Kleos) Fatal(msg string) {
+	generate(k, 0).Fatal(msg)
+}
+
+// Panic logs a fatal message, flushes the output, and panics with the message.
+func (k *Kleos) Panic(msg string) {
+	generate(k, 0).Panic(msg)
+}
 
 // Context records the context so that values stored in the context can be applied to the
 // fields automatically on output.
 func Context(ctx context.Context) Message {
-	return local.Source(pkgoffset).Context(ctx)
+	return local.Context(ctx)
 }
 
 // V applies a verbosity level to a debug message.
 func V(verbosity uint8) Message {
-	return local.Source(pkgoffset).V(verbosity)
+	return local.V(verbosity)
 }
 
 // Error adds the error message as a field, "source", in the output.
 func Error(err error) Message {
-	return local.Source(pkgoffset).Error(err)
+	return local.Error(err)
 }
 
 // With applies the given fields to the log message.
 func With(fields Fields) Message {
-	return local.Source(pkgoffset).With(fields)
+	return local.With(fields)
+}
+
+// Add applies the typed fields to the log message.  See Message.Add.
+func Add(fields ...Field) Message {
+	return local.Add(fields...)
 }
 
-// WithFields applies the given fields to the log message (deprecated).
+// WithFields applies the given fields to the log message.
+//
+// Deprecated: use With, or Bind to add the fields to every message.
 func WithFields(fields Fields) Message {
-	return local.Source(pkgoffset).With(fields)
+	return local.With(fields)
+}
+
+// Bind creates a logger that adds the given fields to every message it logs.  See Kleos.Bind.
+func Bind(fields Fields) *Kleos {
+	return local.Bind(fields)
+}
+
+// Named creates a logger that adds its name to every message it logs.  See Kleos.Named.
+func Named(name string) *Kleos {
+	return local.Named(name)
 }
 
 // Source overrides the package, file, and line number of the log message.  Helpful for
 // middleware.
 func Source(back int) Message {
-	return local.Source(pkgoffset).Source(back + 1)
+	return local.Source(back)
 }
 
 // Debug generates a debug message.  Equivalent to `kleos.V(1).Log("This is a debug
 // messsage!")`.  If the Kleos verbosity is lower than the verbosity of the message, the
 // message will not be output.  Should use `V().Log()` instead.
 func Debug(msg string) {
-	local.Source(pkgoffset).Debug(msg)
+	local.Debug(msg)
 }
 
 // Log logs a message.  If the message has verbosity, it is logged as a debug message (or
@@ -147,10 +243,26 @@ func Debug(msg string) {
 // but has errors, it is logged as an error message.  If it has no verbosity and no
 // errors, it is logged as an info message.
 func Log(msg string) {
-	local.Source(pkgoffset).Log(msg)
+	local.Log(msg)
 }
 
 // Info logs a message.  Deprecated; use Log instead.
 func Info(msg string) {
-	local.Source(pkgoffset).Log(msg)
+	local.Log(msg)
+}
+
+// Warn marks the log message as a warning, for problems that aren't errors, such as a
+// degraded service.
+func Warn() Message {
+	return local.Warn()
+}
+
+// Fatal logs a fatal message, flushes the output, and exits the program with a status of 1.
+func Fatal(msg string) {
+	local.Fatal(msg)
+}
+
+// Panic logs a fatal message, flushes the output, and panics with the message.
+func Panic(msg string) {
+	local.Panic(msg)
 }
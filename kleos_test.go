@@ -2,6 +2,8 @@ package kleos_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -138,3 +140,258 @@ func BenchmarkNoSource(b *testing.B) {
 		kleos.Log("Database is having serious issues related to connections")
 	}
 }
+
+type ctxKey string
+
+func TestInstanceContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var a, b bytes.Buffer
+
+	ka := kleos.New()
+	ka.SetOutput(kleos.NewTextOutput(&a))
+	ka.Register(func(ctx context.Context, fields kleos.Fields) {
+		if id, ok := ctx.Value(ctxKey("request")).(string); ok {
+			fields["request"] = id
+		}
+	})
+
+	kb := kleos.New()
+	kb.SetOutput(kleos.NewTextOutput(&b))
+
+	ctx := context.WithValue(context.Background(), ctxKey("request"), "R1234")
+
+	ka.Context(ctx).Log("Hello World")
+	kb.Context(ctx).Log("Hello World")
+
+	assert.Contains(a.String(), "request=R1234")
+	assert.NotContains(b.String(), "request=R1234")
+}
+
+func TestWithMerges(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+
+	a := kleos.Fields{"a": 1, "shared": "a"}
+	b := kleos.Fields{"b": 2, "shared": "b"}
+
+	log.With(a).With(b).Log("Hello World")
+
+	output := out.String()
+	assert.Contains(output, "a=1")
+	assert.Contains(output, "b=2")
+	assert.Contains(output, "shared=b")
+
+	// Neither map should have been changed
+	assert.Equal(kleos.Fields{"a": 1, "shared": "a"}, a)
+	assert.Equal(kleos.Fields{"b": 2, "shared": "b"}, b)
+}
+
+func TestFieldsUnmodified(t *testing.T) {
+	assert := assert.New(t)
+
+	log := kleos.New()
+	log.Register(func(ctx context.Context, fields kleos.Fields) {
+		fields["request"] = "R1234"
+	})
+
+	fields := kleos.Fields{"name": "hello"}
+
+	for _, out := range []kleos.Writer{
+		kleos.NewTextOutput(io.Discard),
+		kleos.NewColorOutput(io.Discard),
+		kleos.NewJSONOutput(io.Discard),
+		kleos.NewECSOutput("test", io.Discard),
+	} {
+		log.SetOutput(out)
+		log.Context(context.Background()).With(fields).Error(fmt.Errorf("yikes")).Log("Hello World")
+	}
+
+	assert.Equal(kleos.Fields{"name": "hello"}, fields)
+}
+
+func TestBoundFields(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+
+	billing := log.Named("billing").Bind(kleos.Fields{"tenant": "acme"})
+	db := billing.Named("db")
+
+	billing.Log("Hello World")
+	assert.Contains(out.String(), "logger=billing")
+	assert.Contains(out.String(), "tenant=acme")
+	out.Reset()
+
+	db.V(1).Log("Hello World")
+	assert.Empty(out.String())
+
+	// Derived loggers share the settings of the logger they came from
+	log.SetVerbosity(1)
+	db.V(1).Log("Hello World")
+	assert.Contains(out.String(), "logger=billing.db")
+	assert.Contains(out.String(), "tenant=acme")
+	out.Reset()
+
+	// The original logger doesn't pick up the fields
+	log.Log("Hello World")
+	assert.NotContains(out.String(), "logger=")
+	assert.NotContains(out.String(), "tenant=")
+}
+
+func TestWithFieldsMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+
+	// The deprecated WithFields still applies the fields to a single message
+	var m kleos.Message = log.WithFields(kleos.Fields{"tenant": "acme"})
+	m.Log("Hello World")
+	assert.Contains(out.String(), "tenant=acme")
+	assert.Contains(out.String(), "kleos_test.go")
+	out.Reset()
+
+	log.Log("Hello World")
+	assert.NotContains(out.String(), "tenant=")
+}
+
+func TestFieldPrecedence(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.Register(func(ctx context.Context, fields kleos.Fields) {
+		fields["a"] = "context"
+		fields["b"] = "context"
+		fields["c"] = "context"
+	})
+
+	bound := log.Bind(kleos.Fields{"a": "bound", "b": "bound"})
+	bound.Context(context.Background()).With(kleos.Fields{"a": "call"}).Log("Hello World")
+
+	output := out.String()
+	assert.Contains(output, "a=call")
+	assert.Contains(output, "b=bound")
+	assert.Contains(output, "c=context")
+}
+
+func TestEnabled(t *testing.T) {
+	assert := assert.New(t)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(io.Discard))
+	log.SetVerbosity(2)
+
+	assert.True(log.V(2).Enabled())
+	assert.False(log.V(3).Enabled())
+	assert.True(log.With(kleos.Fields{"id": 1}).Enabled())
+	assert.True(log.Error(errors.New("oops")).Enabled())
+}
+
+func TestDisabledAllocations(t *testing.T) {
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetVerbosity(1)
+
+	fields := kleos.Fields{"id": "B8012423573231", "health": 97}
+	billing := log.Named("billing")
+
+	tests := map[string]func(){
+		"V":        func() { log.V(3).Log("Hello World") },
+		"V fields": func() { log.V(3).With(fields).Error(io.EOF).Log("Hello World") },
+		"V Debug":  func() { log.V(3).Debug("Hello World") },
+		"Enabled":  func() { _ = log.V(3).Enabled() },
+		"named":    func() { billing.V(3).Log("Hello World") },
+		"adapter":  func() { log.Logger(3).Printf("Hello %s", "World") },
+		"global":   func() { kleos.V(200).Log("Hello World") },
+	}
+
+	for name, fn := range tests {
+		assert.Zero(t, testing.AllocsPerRun(100, fn), name)
+	}
+
+	// Verbosity overrides are cached per call site, so they don't allocate either
+	assert.NoError(t, log.SetVModule("other=4,kleos=2"))
+
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		log.V(3).Log("Hello World")
+	}), "vmodule")
+
+	assert.Empty(t, out.String())
+}
+
+func BenchmarkDisabled(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	for n := 0; n < b.N; n++ {
+		log.V(3).Log("Database is having serious issues related to connections")
+	}
+}
+
+func BenchmarkDisabledWithFields(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	fields := kleos.Fields{
+		"id":     "B8012423573231",
+		"name":   "NBC Sports",
+		"health": 97,
+	}
+
+	for n := 0; n < b.N; n++ {
+		log.V(3).With(fields).Log("Database is having serious issues related to connections")
+	}
+}
+
+func BenchmarkDisabledVModule(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	if err := log.SetVModule("billing=4,http/*=3"); err != nil {
+		b.Fatal(err)
+	}
+
+	for n := 0; n < b.N; n++ {
+		log.V(3).Log("Database is having serious issues related to connections")
+	}
+}
+
+func BenchmarkDisabledAboveVModule(b *testing.B) {
+	b.ReportAllocs()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(io.Discard))
+	log.SetVerbosity(1)
+
+	if err := log.SetVModule("billing=4,http/*=3"); err != nil {
+		b.Fatal(err)
+	}
+
+	for n := 0; n < b.N; n++ {
+		log.V(5).Log("Database is having serious issues related to connections")
+	}
+}
@@ -0,0 +1,77 @@
+package kleos
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of a log message.  Kleos doesn't ask you to choose a level when
+// logging; it's derived from the message itself.  See Message.Level for details.
+type Level uint8
+
+// Levels of log messages, from lowest to highest severity.  Warnings and fatal messages must
+// be requested explicitly, with Warn, Fatal, or Panic; the other levels are derived.
+const (
+	DebugLevel Level = iota + 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// String returns the lowercase name of the level, e.g. "debug" or "error", as used in the
+// JSON output.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel returns the level with the given name, e.g. "warn" or "ERROR".  Also accepts the
+// common alternatives "warning", "err", and "critical".
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error", "err":
+		return ErrorLevel, nil
+	case "fatal", "critical":
+		return FatalLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Level returns the severity of the message.  Warnings and fatal messages have their level set
+// explicitly.  Otherwise, messages with verbosity are debug messages, messages without
+// verbosity but with an error are error messages, and everything else is an info message.
+func (m Message) Level() Level {
+	if m.level != 0 {
+		return m.level
+	}
+
+	if m.verbosity > 0 {
+		return DebugLevel
+	}
+
+	if m.error != nil {
+		return ErrorLevel
+	}
+
+	return InfoLevel
+}
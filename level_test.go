@@ -0,0 +1,104 @@
+package kleos_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarn(t *testing.T) {
+	assert := assert.New(t)
+
+	var text, json bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.Tee(kleos.NewTextOutput(&text), kleos.NewJSONOutput(&json)))
+
+	log.Warn().With(kleos.Fields{"replicas": 1}).Log("Running without a replica")
+
+	assert.Contains(text.String(), " WRN Running without a replica ")
+	assert.Contains(json.String(), `"level":"warn"`)
+	text.Reset()
+	json.Reset()
+
+	// Warnings may include an error without becoming an error message
+	log.Error(errors.New("timeout")).Warn().Log("Retrying")
+
+	assert.Contains(text.String(), " WRN Retrying ")
+	assert.Contains(text.String(), "err=timeout")
+	assert.Contains(json.String(), `"level":"warn"`)
+	text.Reset()
+
+	// Regular messages still derive their level
+	log.Error(errors.New("timeout")).Log("Failed")
+	assert.Contains(text.String(), " ERR Failed ")
+
+	assert.Equal(kleos.WarnLevel, log.Warn().Level())
+	assert.Equal(kleos.ErrorLevel, log.Error(errors.New("timeout")).Level())
+	assert.Equal(kleos.InfoLevel, log.With(nil).Level())
+	assert.Equal(kleos.DebugLevel, log.V(1).Level())
+}
+
+func TestPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	async := kleos.NewAsyncWriter(kleos.NewTextOutput(&out), 10, kleos.OverflowBlock)
+
+	log := kleos.New()
+	log.SetOutput(async)
+
+	assert.PanicsWithValue("Out of memory", func() {
+		log.With(kleos.Fields{"free": 0}).Panic("Out of memory")
+	})
+
+	// The output was flushed before panicking
+	assert.Contains(out.String(), " FTL Out of memory ")
+	assert.Contains(out.String(), "free=0")
+}
+
+func TestFatal(t *testing.T) {
+	if os.Getenv("KLEOS_FATAL") == "1" {
+		async := kleos.NewAsyncWriter(kleos.NewJSONOutput(os.Stdout), 10, kleos.OverflowBlock)
+		kleos.SetOutput(async)
+		kleos.Fatal("Unable to start")
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestFatal")
+	cmd.Env = append(os.Environ(), "KLEOS_FATAL=1")
+
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 1, exitErr.ExitCode())
+	}
+
+	assert.Contains(t, string(output), `"level":"fatal"`)
+	assert.Contains(t, string(output), `"msg":"Unable to start"`)
+	assert.Contains(t, string(output), `"src":"level_test.go"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]kleos.Level{
+		"debug":    kleos.DebugLevel,
+		"info":     kleos.InfoLevel,
+		"WARNING":  kleos.WarnLevel,
+		"warn":     kleos.WarnLevel,
+		"Error":    kleos.ErrorLevel,
+		"critical": kleos.FatalLevel,
+	} {
+		level, err := kleos.ParseLevel(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, level, name)
+	}
+
+	_, err := kleos.ParseLevel("verbose")
+	assert.Error(t, err)
+}
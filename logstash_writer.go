@@ -3,63 +3,301 @@ package kleos
 import (
 	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	// ErrInvalidConnectionType returned when the connection isn't a TCPConn.  Shouldn't
-	// typically happen.
+	// ErrInvalidConnectionType was returned when the connection wasn't a TCPConn.
+	//
+	// Deprecated: the LogstashWriter dials with a net.Dialer, which sets the keep-alive on
+	// any connection, and reconnects in the background, so this is no longer returned.
 	ErrInvalidConnectionType = errors.New("not a TCP connection")
+
+	// ErrWriterClosed returned when writing to a writer that has been closed.
+	ErrWriterClosed = errors.New("writer closed")
+)
+
+const (
+	// DefaultLogstashQueueSize is the number of log lines the LogstashWriter holds on to
+	// while disconnected from Logstash.
+	DefaultLogstashQueueSize = 1000
+
+	// DefaultMinBackoff is how long the LogstashWriter waits before the first reconnect
+	// attempt.  The wait doubles after each failed attempt, up to DefaultMaxBackoff.
+	DefaultMinBackoff = 100 * time.Millisecond
+
+	// DefaultMaxBackoff is the longest the LogstashWriter waits between reconnect attempts.
+	DefaultMaxBackoff = 30 * time.Second
 )
 
 // LogstashWriter is designed to output log messages to the Logstash TCP input.  Use this with
-// ELKOutput to send log messages to an ELK-compatible stack.
+// JSONOutput or ECSOutput to send log messages to an ELK-compatible stack.
+//
+// If the connection to Logstash is lost, or was never established with Dial, the writer
+// reconnects in the background, waiting with an exponential backoff between attempts.  While
+// disconnected, up to QueueSize log lines are held in memory and sent once the connection is
+// restored; if the queue fills up, the oldest lines are dropped.
+//
+// Configure the LogstashWriter before writing to it.
 type LogstashWriter struct {
-	Host    string
-	Timeout time.Duration
+	sent    uint64 // lines successfully written to Logstash
+	dropped uint64 // lines dropped because the queue was full
 
-	conn   *net.TCPConn
+	Host       string        // the hostname or IP address and port of Logstash
+	Timeout    time.Duration // dial and write timeout; zero for none
+	QueueSize  int           // lines to hold while disconnected; zero to drop them
+	MinBackoff time.Duration // the first wait between reconnect attempts
+	MaxBackoff time.Duration // the longest wait between reconnect attempts
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	queue   [][]byte
+	dialing bool
+	closed  bool
+	done    chan struct{}
 }
 
 // NewLogstashWriter creates a new writer to connect to the Logstash host and output log messages.
-// Host should include hostname or IP address and port of the Logstash TCP service.
+// Host should include hostname or IP address and port of the Logstash TCP service.  The timeout
+// applies to both connecting to Logstash and writing each log line.
 func NewLogstashWriter(host string, timeout time.Duration) *LogstashWriter {
 	return &LogstashWriter{
-		Host:    host,
-		Timeout: timeout,
+		Host:       host,
+		Timeout:    timeout,
+		QueueSize:  DefaultLogstashQueueSize,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		done:       make(chan struct{}),
 	}
 }
 
-func (w *LogstashWriter) Close() {
-	_ = w.conn.Close()
+// Close the connection to Logstash and stop reconnecting.  Any queued log lines are discarded.
+// Returns the error closing the connection, if any, so the writer is an io.Closer.
+func (w *LogstashWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+	close(w.stopped())
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
 }
 
-// Dial connects to the Logstash TCP service.
+// Dial connects to the Logstash TCP service.  Calling Dial is optional; if the writer isn't
+// connected when a log line is written, it connects in the background.
 func (w *LogstashWriter) Dial() error {
-	addr, err := net.ResolveTCPAddr("tcp", w.Host)
+	conn, err := w.dial()
 	if err != nil {
 		return err
 	}
 
-	conn, err := net.Dial("tcp", addr.String())
-	if err != nil {
-		return err
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		_ = conn.Close()
+		return ErrWriterClosed
 	}
 
-	var ok bool
-	if w.conn, ok = conn.(*net.TCPConn); !ok {
-		return ErrInvalidConnectionType
+	if w.conn != nil {
+		_ = w.conn.Close()
 	}
 
-	if err := w.conn.SetKeepAlive(true); err != nil {
+	w.conn = conn
+	w.flush()
+
+	return nil
+}
+
+// Write sends a log line to Logstash.  If the writer is disconnected, the line is queued and
+// sent once the connection is restored, so Write only returns an error if the writer has been
+// closed.
+func (w *LogstashWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	if w.conn != nil && w.flush() && w.send(b) == nil {
+		return len(b), nil
+	}
+
+	w.enqueue(b)
+	w.reconnect()
+
+	return len(b), nil
+}
+
+// Sent returns the number of log lines successfully written to Logstash.
+func (w *LogstashWriter) Sent() uint64 {
+	return atomic.LoadUint64(&w.sent)
+}
+
+// Dropped returns the number of log lines discarded because the queue was full while
+// disconnected from Logstash.
+func (w *LogstashWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Pending returns the number of log lines queued, waiting for a connection to Logstash.
+func (w *LogstashWriter) Pending() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return len(w.queue)
+}
+
+// Connects to Logstash, honoring the timeout.
+func (w *LogstashWriter) dial() (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout:   w.Timeout,
+		KeepAlive: 15 * time.Second,
+	}
+
+	return dialer.Dial("tcp", w.Host)
+}
+
+// Returns the channel closed when the writer is closed.  Must be called with the mutex held.
+func (w *LogstashWriter) stopped() chan struct{} {
+	if w.done == nil {
+		w.done = make(chan struct{})
+	}
+
+	return w.done
+}
+
+// Writes a single log line to the connection.  On failure the connection is closed.  Must be
+// called with the mutex held.
+func (w *LogstashWriter) send(b []byte) error {
+	if w.Timeout > 0 {
+		_ = w.conn.SetWriteDeadline(time.Now().Add(w.Timeout))
+	}
+
+	if _, err := w.conn.Write(b); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
 		return err
 	}
 
+	atomic.AddUint64(&w.sent, 1)
+
 	return nil
 }
 
-// Write sends a block of bytes to the LogstashWriter buffer.  Once an array of bytes with a
-// carriage return at the end is written, the buffer is shipped to Logstash via TCP and reset.
-func (w *LogstashWriter) Write(b []byte) (int, error) {
-	return w.conn.Write(b)
+// Sends any queued log lines.  Returns false if the connection failed along the way.  Must be
+// called with the mutex held.
+func (w *LogstashWriter) flush() bool {
+	for len(w.queue) > 0 {
+		if err := w.send(w.queue[0]); err != nil {
+			return false
+		}
+
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+	}
+
+	w.queue = nil
+
+	return true
+}
+
+// Adds a copy of the log line to the queue, dropping the oldest line if the queue is full.
+// Must be called with the mutex held.
+func (w *LogstashWriter) enqueue(b []byte) {
+	if w.QueueSize <= 0 {
+		atomic.AddUint64(&w.dropped, 1)
+		return
+	}
+
+	if len(w.queue) >= w.QueueSize {
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		atomic.AddUint64(&w.dropped, 1)
+	}
+
+	line := make([]byte, len(b))
+	copy(line, b)
+
+	w.queue = append(w.queue, line)
+}
+
+// Starts reconnecting in the background, if not already.  Must be called with the mutex held.
+func (w *LogstashWriter) reconnect() {
+	if w.dialing || w.closed {
+		return
+	}
+
+	w.dialing = true
+	go w.redial(w.stopped())
+}
+
+// Keeps trying to connect to Logstash, backing off exponentially between attempts, until
+// connected and the queue is flushed or the writer is closed.
+func (w *LogstashWriter) redial(done chan struct{}) {
+	backoff := w.MinBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+
+	maxBackoff := w.MaxBackoff
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+
+	for {
+		conn, err := w.dial()
+
+		w.mutex.Lock()
+		if w.closed {
+			w.mutex.Unlock()
+
+			if conn != nil {
+				_ = conn.Close()
+			}
+
+			return
+		}
+
+		if err == nil {
+			if w.conn != nil {
+				_ = w.conn.Close()
+			}
+
+			w.conn = conn
+			if w.flush() {
+				w.dialing = false
+				w.mutex.Unlock()
+				return
+			}
+		}
+		w.mutex.Unlock()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
 }
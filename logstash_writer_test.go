@@ -0,0 +1,207 @@
+package kleos_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// A stand-in for the Logstash TCP input that can drop and restore its connections.
+type logstashServer struct {
+	sync.Mutex
+
+	addr     string
+	listener net.Listener
+	conns    []net.Conn
+	lines    chan string
+}
+
+func newLogstashServer(t *testing.T) *logstashServer {
+	s := &logstashServer{
+		addr:  "127.0.0.1:0",
+		lines: make(chan string, 100),
+	}
+	s.restore(t)
+
+	t.Cleanup(s.drop)
+
+	return s
+}
+
+// Starts listening on the server's address.
+func (s *logstashServer) restore(t *testing.T) {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Lock()
+	s.addr = listener.Addr().String()
+	s.listener = listener
+	s.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			s.Lock()
+			s.conns = append(s.conns, conn)
+			s.Unlock()
+
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					s.lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+}
+
+// Closes the listener and any open connections.
+func (s *logstashServer) drop() {
+	s.Lock()
+	defer s.Unlock()
+
+	_ = s.listener.Close()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// Waits for the next line received by the server.
+func (s *logstashServer) next(t *testing.T) string {
+	select {
+	case line := <-s.lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a log line")
+		return ""
+	}
+}
+
+func newTestLogstashWriter(host string) *kleos.LogstashWriter {
+	w := kleos.NewLogstashWriter(host, time.Second)
+	w.MinBackoff = 10 * time.Millisecond
+	w.MaxBackoff = 50 * time.Millisecond
+
+	return w
+}
+
+func TestLogstashWithoutDial(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newLogstashServer(t)
+
+	w := newTestLogstashWriter(server.addr)
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := fmt.Fprintf(w, "line %d\n", i)
+		assert.NoError(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(fmt.Sprintf("line %d", i), server.next(t))
+	}
+
+	assert.Equal(uint64(3), w.Sent())
+	assert.Equal(uint64(0), w.Dropped())
+}
+
+func TestLogstashReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newLogstashServer(t)
+
+	w := newTestLogstashWriter(server.addr)
+	defer w.Close()
+
+	assert.NoError(w.Dial())
+
+	_, _ = fmt.Fprintln(w, "before")
+	assert.Equal("before", server.next(t))
+
+	server.drop()
+
+	// The first write after the server goes away may appear to succeed, so keep writing until
+	// the writer notices and starts queuing
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Pending() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("writer never noticed the dropped connection")
+		}
+
+		_, err := fmt.Fprintln(w, "during")
+		assert.NoError(err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, _ = fmt.Fprintln(w, "after")
+
+	server.restore(t)
+
+	for {
+		line := server.next(t)
+		if line == "after" {
+			break
+		}
+		assert.Equal("during", line)
+	}
+
+	assert.Equal(0, w.Pending())
+}
+
+func TestLogstashQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	// Find an address with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	w := newTestLogstashWriter(addr)
+	w.QueueSize = 5
+
+	for i := 0; i < 8; i++ {
+		_, err := fmt.Fprintf(w, "line %d\n", i)
+		assert.NoError(err)
+	}
+
+	assert.Equal(5, w.Pending())
+	assert.Equal(uint64(3), w.Dropped())
+	assert.Equal(uint64(0), w.Sent())
+
+	assert.NoError(w.Close())
+
+	_, err = fmt.Fprintln(w, "closed")
+	assert.ErrorIs(err, kleos.ErrWriterClosed)
+}
+
+func TestLogstashJSONOutput(t *testing.T) {
+	server := newLogstashServer(t)
+
+	w := newTestLogstashWriter(server.addr)
+	defer w.Close()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(w))
+	log.With(kleos.Fields{"name": "James T. Kirk"}).Log("Recording new mission")
+
+	line := server.next(t)
+	assert.Contains(t, line, `"msg":"Recording new mission"`)
+	assert.Contains(t, line, `"name":"James T. Kirk"`)
+}
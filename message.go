@@ -2,43 +2,90 @@ package kleos
 
 import (
 	"context"
-	"runtime"
+	"os"
 	"time"
 )
 
+// FatalFlushTimeout is how long Fatal and Panic wait for the output to flush.
+const FatalFlushTimeout = 5 * time.Second
+
 // Message carries details about the log message as function calls are made.  Note that
 // messages aren't thread-safe, so don't pass them between goroutines (not sure why you'd
 // do that).
 type Message struct {
-	k         *Kleos
+	k         *Kleos          // the logger that generated this message
 	when      time.Time       // when was this message logged
 	pkg       string          // in what package was the message generated
 	file      string          // in what source code file was the message generated
 	line      int             // what line of code generated the message
 	ctx       context.Context // for parsing stored context values into the fields
 	verbosity uint8           // verbosity level, 0-4
+	level     Level           // explicit level, e.g. a warning; derived if not set
 	msg       string          // the human-readable log message
 	error     error           // include details about the error that generated this message
 	fields    Fields          // any custom fields to include, typically as JSON output
+	typed     []Field         // typed fields, in the order they were added
 	source    bool            // include the source file and line number?
 	pc        []uintptr       // store the stacktrace
+	stack     []Frame         // the stack trace for error messages, when enabled
 	skip      int             // how far back in the stacktrace to display source file and line number
+	sampler   *Sampler        // limits how often the same message is output
+	vmodule   *vmodule        // verbosity overrides for packages and source files
+	allowed   uint8           // the logger's verbosity setting
+	limit     uint8           // the verbosity setting for the call site, once resolved
+	limitSkip int             // the skip the limit was resolved at, plus one; zero if unresolved
+	redactor  *Redactor       // hides sensitive values before output
+	resolved  bool            // the bound, error, and context fields are in base and errFields
+	base      Fields          // the resolved bound and context fields
+	errFields Fields          // the resolved error fields
 	out       Writer
 }
 
-func generate(out Writer, source bool) Message {
-	m := Message{
-		when:   time.Now(),
-		source: source,
-		skip:   0,
-		out:    out,
+// Creates a message at the verbosity, capturing the time and source of the message only if
+// it will be output, so filtered debug messages cost next to nothing.  Messages that skipped
+// the capture, e.g. if the verbosity changes, capture what they need when output.
+func generate(k *Kleos, verbosity uint8) Message {
+	return generateAt(k, verbosity, 0)
+}
+
+// Creates a message at the verbosity, like generate, with the source of the message skip calls
+// back from the code that called kleos.  The verbosity overrides are checked at that call.
+func generateAt(k *Kleos, verbosity uint8, skip int) Message {
+	m := newMessage(k)
+	m.verbosity = verbosity
+	m.skip = skip
+	m.resolveThreshold()
+
+	if !m.Enabled() {
+		return m
 	}
 
+	m.when = time.Now()
+
 	// A bit of extra effort so calling Source() repeatedly doesn't cost anything more
-	if source {
-		m.pc = make([]uintptr, 5)
-		_ = runtime.Callers(3, m.pc)
+	if m.source {
+		m.pc = make([]uintptr, maxCallers)
+		m.pc = m.pc[:callers(m.pc)]
+	}
+
+	return m
+}
+
+// Creates a message using the logger's settings, but doesn't capture the time or the source.
+func newMessage(k *Kleos) Message {
+	root := k.base()
+
+	root.RLock()
+	m := Message{
+		k:        k,
+		source:   root.includeSource,
+		out:      root.output,
+		sampler:  root.sampler,
+		vmodule:  root.vmodule,
+		allowed:  root.verbosity,
+		redactor: root.redactor,
 	}
+	root.RUnlock()
 
 	return m
 }
@@ -62,15 +109,52 @@ func (m Message) Error(err error) Message {
 	return m
 }
 
-// With applies the given fields to the log message.
+// With applies the given fields to the log message.  Calling With more than once merges the
+// fields; if a field is repeated, the last value wins.  The fields map isn't modified.
 func (m Message) With(fields Fields) Message {
-	m.fields = fields
+	if len(m.fields) == 0 {
+		m.fields = fields
+		return m
+	}
+
+	merged := make(Fields, len(m.fields)+len(fields))
+	for k, v := range m.fields {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	m.fields = merged
+
+	return m
+}
+
+// Add applies the typed fields to the log message, e.g. `Add(kleos.String("user", id))`.
+// Calling Add more than once appends the fields; if a field is repeated, the last value wins.
+// Typed fields take precedence over fields passed to With.
+func (m Message) Add(fields ...Field) Message {
+	if len(m.typed) == 0 {
+		m.typed = fields
+		return m
+	}
+
+	// Don't let derived messages write over each other's fields
+	m.typed = append(m.typed[:len(m.typed):len(m.typed)], fields...)
+
 	return m
 }
 
 // WithFields applies the given fields to the log message (deprecated).
 func (m Message) WithFields(fields Fields) Message {
-	m.fields = fields
+	return m.With(fields)
+}
+
+// Warn marks the message as a warning, for problems that aren't errors, such as a degraded
+// service.  The message may still include an error.
+func (m Message) Warn() Message {
+	m.level = WarnLevel
 	return m
 }
 
@@ -91,7 +175,7 @@ func (m Message) Debug(msg string) {
 		m.verbosity = 1
 	}
 
-	if m.verbosity > Verbosity() {
+	if !m.Enabled() {
 		return
 	}
 
@@ -105,14 +189,254 @@ func (m Message) Debug(msg string) {
 func (m Message) Log(msg string) {
 	m.msg = msg
 
-	if m.verbosity > 0 && m.verbosity > Verbosity() {
+	if !m.Enabled() {
 		return
 	}
 
 	m.Output()
 }
 
+// Enabled reports whether the message will be output, based on its verbosity.  Use it to skip
+// expensive work preparing a debug message that won't be logged:
+//
+//	if m := kleos.V(3); m.Enabled() {
+//		m.With(kleos.Fields{"body": dump(req)}).Log("Request")
+//	}
+func (m Message) Enabled() bool {
+	return m.verbosity == 0 || m.verbosity <= m.threshold()
+}
+
 // Info logs a message.  Deprecated; use Log instead.
 func (m Message) Info(msg string) {
 	m.Log(msg)
 }
+
+// Fatal logs a fatal message regardless of verbosity, flushes the output, and exits the
+// program with a status of 1.
+func (m Message) Fatal(msg string) {
+	m.msg = msg
+	m.level = FatalLevel
+
+	m.Output()
+	m.flush()
+
+	os.Exit(1)
+}
+
+// Panic logs a fatal message regardless of verbosity, flushes the output, and panics with the
+// message.
+func (m Message) Panic(msg string) {
+	m.msg = msg
+	m.level = FatalLevel
+
+	m.Output()
+	m.flush()
+
+	panic(msg)
+}
+
+// Returns the verbosity setting of the Kleos instance that generated the message, or the
+// verbosity override for the message's call site; see SetVModule.  Messages without a Kleos
+// instance never output debug messages.
+func (m Message) threshold() uint8 {
+	if m.k == nil {
+		return 0
+	}
+
+	if m.vmodule == nil {
+		return m.allowed
+	}
+
+	// No override would output the message, so don't bother looking up the call site
+	if m.verbosity > m.allowed && m.verbosity > m.vmodule.max {
+		return m.allowed
+	}
+
+	if m.limitSkip == m.skip+1 {
+		return m.limit
+	}
+
+	if pc, ok := m.callSite(); ok {
+		if verbosity, ok := m.vmodule.verbosity(pc); ok {
+			return verbosity
+		}
+	}
+
+	return m.allowed
+}
+
+// Looks up the verbosity setting for the message's call site once, when the message is
+// generated, so logging the message doesn't walk the stack again.  Only needed for the
+// verbosity overrides.
+func (m *Message) resolveThreshold() {
+	if m.k == nil || m.vmodule == nil || m.verbosity == 0 {
+		return
+	}
+
+	// Not cached, in case V changes the verbosity later
+	if m.verbosity > m.allowed && m.verbosity > m.vmodule.max {
+		return
+	}
+
+	m.limit = m.threshold()
+	m.limitSkip = m.skip + 1
+}
+
+// Returns the program counter of the code that logged the message, for the verbosity
+// overrides.  Doesn't allocate, unlike capturing the source.
+func (m Message) callSite() (uintptr, bool) {
+	if m.pc != nil {
+		if m.skip >= 0 && m.skip < len(m.pc) {
+			return m.pc[m.skip], true
+		}
+		return 0, false
+	}
+
+	var pc [maxCallers]uintptr
+	n := callers(pc[:])
+
+	if m.skip < 0 || m.skip >= n {
+		return 0, false
+	}
+
+	return pc[m.skip], true
+}
+
+// Waits for the message's output to write any buffered messages, so they aren't lost when the
+// program exits.
+func (m Message) flush() {
+	flusher, ok := m.out.(Flusher)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FatalFlushTimeout)
+	defer cancel()
+
+	if err := flusher.Flush(ctx); err != nil {
+		reportError(err)
+	}
+}
+
+// Applies the context functions registered with the Kleos instance that generated the
+// message to the fields.
+func (m Message) applyContext(fields Fields) {
+	if m.k == nil {
+		return
+	}
+
+	m.k.base().contexts.Run(m.ctx, fields)
+}
+
+// Time returns when the message was logged.
+func (m Message) Time() time.Time {
+	return m.when
+}
+
+// Text returns the human-readable log message.
+func (m Message) Text() string {
+	return m.msg
+}
+
+// Verbosity returns the verbosity of a debug message, or zero if it's not a debug message.
+func (m Message) Verbosity() uint8 {
+	return m.verbosity
+}
+
+// Err returns the error attached to the message, if any.
+func (m Message) Err() error {
+	return m.error
+}
+
+// Package returns the name of the package in which the message was logged.  Empty if source
+// reporting is disabled.
+func (m Message) Package() string {
+	return m.pkg
+}
+
+// File returns the name of the source file in which the message was logged.  Empty if source
+// reporting is disabled.
+func (m Message) File() string {
+	return m.file
+}
+
+// Line returns the line number of the source code that logged the message.  Zero if source
+// reporting is disabled.
+func (m Message) Line() int {
+	return m.line
+}
+
+// Fields returns a copy of the fields attached to the message, including the fields bound to
+// the logger, the fields contributed by the error (see LogFielder), and any values pulled from
+// the context by the registered context functions.  Typed fields passed to Add take precedence
+// over fields passed to With, which take precedence over the error's fields, which take
+// precedence over bound fields, which take precedence over the context values.
+func (m Message) Fields() Fields {
+	fields := m.untypedFields()
+	if fields == nil {
+		fields = make(Fields, len(m.typed))
+	}
+
+	for _, f := range m.typed {
+		fields[f.Key] = f.Value()
+	}
+
+	return fields
+}
+
+// Returns the fields attached to the message other than the typed fields, or nil if there
+// aren't any.  Outputs that encode the typed fields themselves use this instead of Fields.
+func (m Message) untypedFields() Fields {
+	return m.mergeFields(m.ErrorFields())
+}
+
+// Merges the context values, bound fields, error fields, and fields passed to With, in order of
+// precedence.  Returns nil if there aren't any.
+func (m Message) mergeFields(errFields Fields) Fields {
+	base := m.base
+	if !m.resolved {
+		base = m.boundFields()
+	}
+
+	if len(base) == 0 && len(errFields) == 0 && len(m.fields) == 0 {
+		return nil
+	}
+
+	fields := make(Fields, len(base)+len(errFields)+len(m.fields))
+
+	for k, v := range base {
+		fields[k] = v
+	}
+
+	for k, v := range errFields {
+		fields[k] = v
+	}
+
+	for k, v := range m.fields {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// Returns the context values and the fields bound to the logger, or nil if there aren't any.
+func (m Message) boundFields() Fields {
+	var bound Fields
+	if m.k != nil {
+		bound = m.k.fields
+	}
+
+	if len(bound) == 0 && m.ctx == nil {
+		return nil
+	}
+
+	fields := make(Fields, len(bound))
+
+	m.applyContext(fields)
+
+	for k, v := range bound {
+		fields[k] = v
+	}
+
+	return fields
+}
@@ -0,0 +1,195 @@
+package kleos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Filter decides whether a message should be written to an output.  Return true to write the
+// message.
+type Filter func(m Message) bool
+
+// MultiWriter writes each message to several outputs, e.g. color text to stdout and JSON to
+// Logstash.  Each output may have its own filters; a message is only written to an output if
+// every one of the output's filters accepts it.
+//
+// If any of the outputs fails, the message is still written to the rest, and the errors are
+// returned together.
+type MultiWriter struct {
+	sync.RWMutex
+	outputs []filteredOutput
+}
+
+type filteredOutput struct {
+	out     Writer
+	filters []Filter
+}
+
+// NewMultiWriter creates an empty MultiWriter.  Use Add to attach outputs to it.
+func NewMultiWriter() *MultiWriter {
+	return &MultiWriter{}
+}
+
+// Tee creates a MultiWriter that writes every message to all the outputs.
+func Tee(outputs ...Writer) *MultiWriter {
+	w := NewMultiWriter()
+	for _, out := range outputs {
+		w.Add(out)
+	}
+
+	return w
+}
+
+// Add an output to the MultiWriter.  The output only receives messages accepted by all the
+// filters.  Returns the MultiWriter, so calls may be chained:
+//
+//	kleos.SetOutput(kleos.NewMultiWriter().
+//		Add(kleos.NewColorOutput(os.Stdout)).
+//		Add(kleos.NewJSONOutput(logstash), kleos.MinLevel(kleos.InfoLevel)))
+func (w *MultiWriter) Add(out Writer, filters ...Filter) *MultiWriter {
+	w.Lock()
+	defer w.Unlock()
+
+	w.outputs = append(w.outputs, filteredOutput{
+		out:     out,
+		filters: filters,
+	})
+
+	return w
+}
+
+// Write the message to each output whose filters accept it.
+func (w *MultiWriter) Write(m Message) error {
+	w.RLock()
+	defer w.RUnlock()
+
+	var errs []error
+
+	for _, output := range w.outputs {
+		if !output.accepts(m) {
+			continue
+		}
+
+		if err := output.out.Write(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close any of the outputs that implement io.Closer, such as an AsyncWriter.
+func (w *MultiWriter) Close() error {
+	w.RLock()
+	defer w.RUnlock()
+
+	var errs []error
+
+	for _, output := range w.outputs {
+		if closer, ok := output.out.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Flush any of the outputs that buffer messages, such as an AsyncWriter.
+func (w *MultiWriter) Flush(ctx context.Context) error {
+	w.RLock()
+	defer w.RUnlock()
+
+	var errs []error
+
+	for _, output := range w.outputs {
+		if flusher, ok := output.out.(Flusher); ok {
+			if err := flusher.Flush(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Does every filter accept the message?
+func (o filteredOutput) accepts(m Message) bool {
+	for _, filter := range o.filters {
+		if !filter(m) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MinLevel accepts messages at or above the given level, e.g. MinLevel(InfoLevel) ignores
+// debug messages.
+func MinLevel(level Level) Filter {
+	return func(m Message) bool {
+		return m.Level() >= level
+	}
+}
+
+// MaxVerbosity accepts debug messages up to the given verbosity, along with all non-debug
+// messages.  Use this to send less detail to an output than the Kleos verbosity allows.
+func MaxVerbosity(verbosity uint8) Filter {
+	return func(m Message) bool {
+		return m.verbosity <= verbosity
+	}
+}
+
+// Packages accepts messages logged from any of the given packages.  Requires source reporting
+// to be enabled.
+func Packages(pkgs ...string) Filter {
+	return func(m Message) bool {
+		for _, pkg := range pkgs {
+			if m.pkg == pkg {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// TimeRange accepts messages logged at or after since and before until.  Leave either time zero
+// for no limit.  Mostly useful when reading old messages; see MessageReader.
+func TimeRange(since, until time.Time) Filter {
+	return func(m Message) bool {
+		if !since.IsZero() && m.when.Before(since) {
+			return false
+		}
+
+		return until.IsZero() || m.when.Before(until)
+	}
+}
+
+// HasField accepts messages that include the field, either directly or from the context.
+func HasField(key string) Filter {
+	return func(m Message) bool {
+		_, ok := m.Fields()[key]
+		return ok
+	}
+}
+
+// FieldEquals accepts messages that include the field with the given value.
+func FieldEquals(key string, value any) Filter {
+	return func(m Message) bool {
+		v, ok := m.Fields()[key]
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// Not accepts the messages the filter rejects.
+func Not(filter Filter) Filter {
+	return func(m Message) bool {
+		return !filter(m)
+	}
+}
@@ -0,0 +1,91 @@
+package kleos_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// A Writer that always fails.
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(_ kleos.Message) error {
+	return w.err
+}
+
+func TestTee(t *testing.T) {
+	assert := assert.New(t)
+
+	var text, json bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.Tee(kleos.NewTextOutput(&text), kleos.NewJSONOutput(&json)))
+
+	log.With(kleos.Fields{"name": "hello"}).Log("Hello World")
+
+	assert.Contains(text.String(), " Hello World ")
+	assert.Contains(json.String(), `"msg":"Hello World"`)
+}
+
+func TestMultiWriterFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	var all, info, detail, billing, local, tenant bytes.Buffer
+
+	log := kleos.New()
+	log.SetVerbosity(3)
+	log.SetOutput(kleos.NewMultiWriter().
+		Add(kleos.NewTextOutput(&all)).
+		Add(kleos.NewTextOutput(&info), kleos.MinLevel(kleos.InfoLevel)).
+		Add(kleos.NewTextOutput(&detail), kleos.MaxVerbosity(2)).
+		Add(kleos.NewTextOutput(&billing), kleos.Packages("billing")).
+		Add(kleos.NewTextOutput(&local), kleos.Packages("billing", "kleos")).
+		Add(kleos.NewTextOutput(&tenant), kleos.FieldEquals("tenant", "acme"), kleos.Not(kleos.HasField("secret"))))
+
+	log.Log("info")
+	log.V(2).Log("debug2")
+	log.V(3).Log("debug3")
+	log.With(kleos.Fields{"tenant": "acme"}).Log("acme")
+	log.With(kleos.Fields{"tenant": "acme", "secret": true}).Log("secret")
+
+	lines := func(buf bytes.Buffer) int {
+		return strings.Count(buf.String(), "\n")
+	}
+
+	assert.Equal(5, lines(all))
+	assert.Equal(3, lines(info))
+	assert.NotContains(info.String(), "debug")
+	assert.Equal(4, lines(detail))
+	assert.NotContains(detail.String(), "debug3")
+	assert.Equal(0, lines(billing))
+	assert.Equal(5, lines(local))
+	assert.Equal(1, lines(tenant))
+	assert.Contains(tenant.String(), " acme ")
+}
+
+func TestMultiWriterErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	first := errors.New("first failed")
+	second := errors.New("second failed")
+
+	w := kleos.NewMultiWriter().
+		Add(failingWriter{first}).
+		Add(kleos.NewTextOutput(&out)).
+		Add(failingWriter{second})
+
+	err := w.Write(kleos.Message{})
+	assert.ErrorIs(err, first)
+	assert.ErrorIs(err, second)
+
+	// The working output still received the message
+	assert.Contains(out.String(), "INF")
+}
@@ -0,0 +1,477 @@
+package kleos
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOTLPEndpoint is the default OTLP/HTTP logs endpoint of a local OpenTelemetry
+	// collector.
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/logs"
+
+	// DefaultOTLPBatchSize is the number of log records the OTLPExporter sends at once.
+	DefaultOTLPBatchSize = 512
+
+	// DefaultOTLPInterval is the longest the OTLPExporter holds on to log records before
+	// sending them.
+	DefaultOTLPInterval = 5 * time.Second
+
+	// OTLPTraceID is the field holding the trace ID, if there's no TraceContextFunc.
+	OTLPTraceID = "trace_id"
+
+	// OTLPSpanID is the field holding the span ID, if there's no TraceContextFunc.
+	OTLPSpanID = "span_id"
+
+	// The instrumentation scope reported to the collector.
+	otlpScope = "github.com/sbowman/kleos"
+)
+
+// TraceContextFunc returns the trace ID and span ID of the span in the context, hex-encoded.
+// Returns empty strings if there's no span.  For example, with the OpenTelemetry trace
+// package:
+//
+//	exporter.TraceContext = func(ctx context.Context) (string, string) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		if !sc.IsValid() {
+//			return "", ""
+//		}
+//		return sc.TraceID().String(), sc.SpanID().String()
+//	}
+type TraceContextFunc func(ctx context.Context) (traceID, spanID string)
+
+// OTLPExporter is a Writer that exports log messages to an OpenTelemetry collector, using the
+// OTLP/HTTP protocol with JSON encoding.  Messages are sent in batches, once BatchSize messages
+// are waiting or Interval has passed since the first of them was written.  Writes that fill a
+// batch wait for it to be sent; wrap the exporter in an AsyncWriter so logging never waits on
+// the collector.  Call Flush or Close before shutting down so no messages are lost.
+//
+// Messages are mapped to the OpenTelemetry logs data model:
+//
+// * The message is the log record's body.
+// * The level is mapped to the severity number:  info is INFO (9), warnings are WARN (13),
+// errors are ERROR (17), and fatal messages are FATAL (21).  Debug messages at verbosity 1
+// through 4 are DEBUG4 (8) through DEBUG (5), and higher verbosities are TRACE.
+// * The fields are attributes, along with the source as `code.namespace`, `code.filepath`,
+// and `code.lineno`, and the error as `exception.message`, `exception.type`, and
+// `exception.stacktrace`.
+// * The trace and span IDs come from the message's context, using TraceContext.  Without
+// a TraceContextFunc, the `trace_id` and `span_id` fields are used, e.g. as added by a
+// ContextFunc.
+// * The Resource attributes describe the service; NewOTLPExporter sets `service.name` and
+// `host.name`.
+//
+// Configure the OTLPExporter before writing to it.
+type OTLPExporter struct {
+	Endpoint     string            // the collector's OTLP/HTTP logs endpoint
+	Headers      map[string]string // additional HTTP headers, e.g. for authentication
+	Client       *http.Client      // the HTTP client; defaults to http.DefaultClient
+	Resource     Fields            // attributes describing the service
+	BatchSize    int               // messages to send at once
+	Interval     time.Duration     // the longest to wait before sending messages
+	TraceContext TraceContextFunc  // returns the trace and span IDs from a context
+
+	mutex sync.Mutex
+	batch []otlpLogRecord
+	timer *time.Timer
+
+	sending sync.Mutex // sends one batch at a time
+}
+
+// NewOTLPExporter creates an exporter that sends log messages to the OTLP/HTTP logs endpoint,
+// e.g. DefaultOTLPEndpoint.  The service is reported as the `service.name` resource
+// attribute, and the system's host name as `host.name`.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	resource := Fields{"service.name": service}
+	if host, err := os.Hostname(); err == nil {
+		resource["host.name"] = host
+	}
+
+	return &OTLPExporter{
+		Endpoint:  endpoint,
+		Resource:  resource,
+		BatchSize: DefaultOTLPBatchSize,
+		Interval:  DefaultOTLPInterval,
+	}
+}
+
+// Write adds the message to the current batch, sending the batch if it's full.
+func (w *OTLPExporter) Write(m Message) error {
+	record := w.record(m)
+
+	w.mutex.Lock()
+
+	w.batch = append(w.batch, record)
+
+	if len(w.batch) < w.BatchSize {
+		if w.timer == nil && w.Interval > 0 {
+			w.timer = time.AfterFunc(w.Interval, w.timeout)
+		}
+
+		w.mutex.Unlock()
+		return nil
+	}
+
+	batch := w.take()
+	w.mutex.Unlock()
+
+	return w.send(context.Background(), batch)
+}
+
+// Flush sends any waiting messages to the collector.
+func (w *OTLPExporter) Flush(ctx context.Context) error {
+	w.mutex.Lock()
+	batch := w.take()
+	w.mutex.Unlock()
+
+	return w.send(ctx, batch)
+}
+
+// Close sends any waiting messages to the collector.  The exporter may still be written to
+// afterwards.
+func (w *OTLPExporter) Close() error {
+	return w.Flush(context.Background())
+}
+
+// Sends the batch when the interval has passed.
+func (w *OTLPExporter) timeout() {
+	if err := w.Flush(context.Background()); err != nil {
+		reportError(err)
+	}
+}
+
+// Removes and returns the current batch, and stops the timer.  Must be called with the mutex
+// held.
+func (w *OTLPExporter) take() []otlpLogRecord {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	batch := w.batch
+	w.batch = nil
+
+	return batch
+}
+
+// Sends the log records to the collector as an ExportLogsServiceRequest.
+func (w *OTLPExporter) send(ctx context.Context, batch []otlpLogRecord) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	req := otlpRequest{
+		ResourceLogs: []otlpResourceLogs{{
+			Resource: otlpResource{Attributes: otlpAttributes(w.Resource)},
+			ScopeLogs: []otlpScopeLogs{{
+				Scope:      otlpScopeInfo{Name: otlpScope},
+				LogRecords: batch,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	w.sending.Lock()
+	defer w.sending.Unlock()
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP export failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Converts the message to an OTLP log record.
+func (w *OTLPExporter) record(m Message) otlpLogRecord {
+	fields := appendMessageFields(make([]Field, 0, len(m.typed)+8), m.untypedFields(), m.typed)
+
+	record := otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(m.when.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       otlpSeverity(m),
+		SeverityText:         strings.ToUpper(m.Level().String()),
+		Body:                 otlpValue{StringValue: strings.TrimSpace(m.msg)},
+	}
+
+	var traceID, spanID string
+	if w.TraceContext != nil && m.ctx != nil {
+		traceID, spanID = w.TraceContext(m.ctx)
+	} else {
+		traceID = fieldString(fields, OTLPTraceID)
+		spanID = fieldString(fields, OTLPSpanID)
+	}
+
+	if otlpID(traceID, 16) {
+		record.TraceID = strings.ToLower(traceID)
+	}
+
+	if otlpID(spanID, 8) {
+		record.SpanID = strings.ToLower(spanID)
+	}
+
+	if m.verbosity > 0 {
+		fields = append(fields, Int("verbosity", int(m.verbosity)))
+	}
+
+	if m.file != "" {
+		fields = append(fields,
+			String("code.namespace", m.pkg),
+			String("code.filepath", m.file),
+			Int("code.lineno", m.line),
+		)
+	}
+
+	if m.error != nil {
+		fields = append(fields, String("exception.message", m.error.Error()))
+		if errType := errorType(m.error); errType != "" {
+			fields = append(fields, String("exception.type", errType))
+		}
+
+		if len(m.stack) > 0 {
+			fields = append(fields, String("exception.stacktrace", stackTrace(m.stack)))
+		}
+	}
+
+	fields = sortFields(fields)
+	record.Attributes = make([]otlpKeyValue, 0, len(fields))
+
+	for _, f := range fields {
+		// The trace and span IDs are reported in the record itself
+		if f.Key == OTLPTraceID && record.TraceID != "" || f.Key == OTLPSpanID && record.SpanID != "" {
+			continue
+		}
+
+		record.Attributes = append(record.Attributes, otlpKeyValue{Key: f.Key, Value: otlpFieldValue(f)})
+	}
+
+	return record
+}
+
+// Maps the message's level to an OpenTelemetry severity number.
+func otlpSeverity(m Message) int {
+	switch m.Level() {
+	case DebugLevel:
+		if m.verbosity >= 8 {
+			return 1
+		}
+		return 9 - int(m.verbosity)
+	case WarnLevel:
+		return 13
+	case ErrorLevel:
+		return 17
+	case FatalLevel:
+		return 21
+	default:
+		return 9
+	}
+}
+
+// Is the ID a valid, non-zero, hex-encoded ID of the given number of bytes?
+func otlpID(id string, size int) bool {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != size {
+		return false
+	}
+
+	for _, c := range b {
+		if c != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Converts the fields to OTLP attributes, sorted by key.
+func otlpAttributes(fields Fields) []otlpKeyValue {
+	attrs := make([]otlpKeyValue, 0, len(fields))
+	for _, k := range sortedKeys(fields) {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpAnyValue(fields[k])})
+	}
+
+	return attrs
+}
+
+// Converts a typed field's value to an OTLP AnyValue, without boxing it.
+func otlpFieldValue(f Field) otlpValue {
+	switch f.kind {
+	case stringField:
+		return otlpValue{StringValue: f.str}
+	case intField, int64Field:
+		return otlpValue{IntValue: strconv.FormatInt(f.num, 10)}
+	case float64Field:
+		return otlpDouble(f.float())
+	case boolField:
+		v := f.num == 1
+		return otlpValue{BoolValue: &v}
+	case objectField:
+		return otlpAnyValue(f.value)
+	}
+
+	return otlpValue{StringValue: encodePlainField(f)}
+}
+
+// Converts a field value to an OTLP AnyValue.
+func otlpAnyValue(value any) otlpValue {
+	switch v := value.(type) {
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		return otlpValue{IntValue: strconv.FormatInt(int64(v), 10)}
+	case int8:
+		return otlpValue{IntValue: strconv.FormatInt(int64(v), 10)}
+	case int16:
+		return otlpValue{IntValue: strconv.FormatInt(int64(v), 10)}
+	case int32:
+		return otlpValue{IntValue: strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return otlpValue{IntValue: strconv.FormatInt(v, 10)}
+	case uint8:
+		return otlpValue{IntValue: strconv.FormatUint(uint64(v), 10)}
+	case uint16:
+		return otlpValue{IntValue: strconv.FormatUint(uint64(v), 10)}
+	case uint32:
+		return otlpValue{IntValue: strconv.FormatUint(uint64(v), 10)}
+	case uint:
+		return otlpUint(uint64(v))
+	case uint64:
+		return otlpUint(v)
+	case float32:
+		return otlpDouble(float64(v))
+	case float64:
+		return otlpDouble(v)
+	default:
+		return otlpValue{StringValue: encodePlain(v)}
+	}
+}
+
+// OTLP integers are signed 64-bit, so larger unsigned integers are sent as strings.
+func otlpUint(u uint64) otlpValue {
+	if u > math.MaxInt64 {
+		return otlpValue{StringValue: strconv.FormatUint(u, 10)}
+	}
+
+	return otlpValue{IntValue: strconv.FormatUint(u, 10)}
+}
+
+// JSON doesn't support NaN or infinity, so those are sent as strings.
+func otlpDouble(f float64) otlpValue {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return otlpValue{StringValue: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+
+	return otlpValue{DoubleValue: &f}
+}
+
+// Returns the keys of the fields, sorted.
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// The parts of the OTLP ExportLogsServiceRequest, in its JSON encoding.
+
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScopeInfo   `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScopeInfo struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpValue      `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// Only one of the values is set.  A string value is always output, even if empty, unless one
+// of the other values is set.
+type otlpValue struct {
+	StringValue string   `json:"-"`
+	BoolValue   *bool    `json:"-"`
+	IntValue    string   `json:"-"`
+	DoubleValue *float64 `json:"-"`
+}
+
+// MarshalJSON outputs only the value that's set.
+func (v otlpValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case v.BoolValue != nil:
+		return json.Marshal(map[string]bool{"boolValue": *v.BoolValue})
+	case v.IntValue != "":
+		return json.Marshal(map[string]string{"intValue": v.IntValue})
+	case v.DoubleValue != nil:
+		return json.Marshal(map[string]float64{"doubleValue": *v.DoubleValue})
+	default:
+		return json.Marshal(map[string]string{"stringValue": v.StringValue})
+	}
+}
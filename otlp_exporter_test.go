@@ -0,0 +1,273 @@
+package kleos_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// The parts of an OTLP ExportLogsServiceRequest the tests check.
+type otlpRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []otlpRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber"`
+	SeverityText   string          `json:"severityText"`
+	Body           map[string]any  `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes"`
+	TraceID        string          `json:"traceId"`
+	SpanID         string          `json:"spanId"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// Returns the attribute's value, e.g. {"stringValue": "jdoe"}, or nil if it's missing.
+func attribute(attrs []otlpAttribute, key string) map[string]any {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+
+	return nil
+}
+
+// A stand-in for an OpenTelemetry collector's OTLP/HTTP logs endpoint.
+func newCollector(t *testing.T) (*httptest.Server, <-chan otlpRequest) {
+	requests := make(chan otlpRequest, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		requests <- req
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+// Waits for the next export request.
+func nextExport(t *testing.T, requests <-chan otlpRequest) otlpRequest {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an export request")
+		return otlpRequest{}
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	assert := assert.New(t)
+
+	server, requests := newCollector(t)
+
+	exporter := kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing")
+	exporter.Resource["host.name"] = "test-host"
+
+	log := kleos.New()
+	log.SetOutput(exporter)
+
+	log.With(kleos.Fields{
+		"user": "jdoe", "count": 3, "ok": true, "ratio": 0.5,
+		"bytes": uint(4096), "id": uint64(math.MaxUint64),
+	}).Info("Invoice paid")
+	log.Error(errors.New("boom")).Log("Invoice failed")
+
+	assert.NoError(log.Flush(context.Background()))
+
+	req := nextExport(t, requests)
+	if !assert.Len(req.ResourceLogs, 1) || !assert.Len(req.ResourceLogs[0].ScopeLogs, 1) {
+		return
+	}
+
+	resource := req.ResourceLogs[0].Resource.Attributes
+	assert.Equal(map[string]any{"stringValue": "billing"}, attribute(resource, "service.name"))
+	assert.Equal(map[string]any{"stringValue": "test-host"}, attribute(resource, "host.name"))
+
+	scope := req.ResourceLogs[0].ScopeLogs[0]
+	assert.Equal("github.com/sbowman/kleos", scope.Scope.Name)
+
+	records := scope.LogRecords
+	if !assert.Len(records, 2) {
+		return
+	}
+
+	info := records[0]
+	assert.Equal(9, info.SeverityNumber)
+	assert.Equal("INFO", info.SeverityText)
+	assert.Equal(map[string]any{"stringValue": "Invoice paid"}, info.Body)
+	assert.NotEmpty(info.TimeUnixNano)
+	assert.Equal(map[string]any{"stringValue": "jdoe"}, attribute(info.Attributes, "user"))
+	assert.Equal(map[string]any{"intValue": "3"}, attribute(info.Attributes, "count"))
+	assert.Equal(map[string]any{"boolValue": true}, attribute(info.Attributes, "ok"))
+	assert.Equal(map[string]any{"doubleValue": 0.5}, attribute(info.Attributes, "ratio"))
+	assert.Equal(map[string]any{"intValue": "4096"}, attribute(info.Attributes, "bytes"))
+	assert.Equal(map[string]any{"stringValue": "18446744073709551615"}, attribute(info.Attributes, "id"))
+	assert.Equal(map[string]any{"stringValue": "otlp_exporter_test.go"}, attribute(info.Attributes, "code.filepath"))
+	assert.Empty(info.TraceID)
+
+	failed := records[1]
+	assert.Equal(17, failed.SeverityNumber)
+	assert.Equal(map[string]any{"stringValue": "boom"}, attribute(failed.Attributes, "exception.message"))
+	assert.Equal(map[string]any{"stringValue": "*errors.errorString"}, attribute(failed.Attributes, "exception.type"))
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	assert := assert.New(t)
+
+	server, requests := newCollector(t)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing"))
+	log.SetVerbosity(10)
+
+	log.V(1).Log("v1")
+	log.V(4).Log("v4")
+	log.V(10).Log("v10")
+	log.Warn().Log("warn")
+
+	assert.NoError(log.Flush(context.Background()))
+
+	var severities []int
+	for _, record := range nextExport(t, requests).ResourceLogs[0].ScopeLogs[0].LogRecords {
+		severities = append(severities, record.SeverityNumber)
+	}
+
+	assert.Equal([]int{8, 5, 1, 13}, severities)
+}
+
+func TestOTLPBatching(t *testing.T) {
+	assert := assert.New(t)
+
+	server, requests := newCollector(t)
+
+	exporter := kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing")
+	exporter.BatchSize = 2
+	exporter.Interval = 50 * time.Millisecond
+
+	log := kleos.New()
+	log.SetOutput(exporter)
+
+	// Full batches are sent right away
+	log.Info("one")
+	log.Info("two")
+	assert.Len(nextExport(t, requests).ResourceLogs[0].ScopeLogs[0].LogRecords, 2)
+
+	// Partial batches are sent after the interval
+	log.Info("three")
+	assert.Len(nextExport(t, requests).ResourceLogs[0].ScopeLogs[0].LogRecords, 1)
+}
+
+type spanKey struct{}
+
+func TestOTLPTraceContext(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	server, requests := newCollector(t)
+
+	exporter := kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing")
+	exporter.TraceContext = func(ctx context.Context) (string, string) {
+		ids, _ := ctx.Value(spanKey{}).([2]string)
+		return ids[0], ids[1]
+	}
+
+	log := kleos.New()
+	log.SetOutput(exporter)
+
+	ctx := context.WithValue(context.Background(), spanKey{}, [2]string{traceID, spanID})
+
+	log.Context(ctx).Info("traced")
+	log.Info("untraced")
+
+	assert.NoError(exporter.Close())
+
+	records := nextExport(t, requests).ResourceLogs[0].ScopeLogs[0].LogRecords
+	if !assert.Len(records, 2) {
+		return
+	}
+
+	assert.Equal(traceID, records[0].TraceID)
+	assert.Equal(spanID, records[0].SpanID)
+	assert.Empty(records[1].TraceID)
+	assert.Empty(records[1].SpanID)
+}
+
+func TestOTLPTraceFields(t *testing.T) {
+	assert := assert.New(t)
+
+	server, requests := newCollector(t)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing"))
+
+	// Without a TraceContextFunc, a context function may add the IDs as fields
+	log.Register(func(ctx context.Context, fields kleos.Fields) {
+		if ids, ok := ctx.Value(spanKey{}).([2]string); ok {
+			fields[kleos.OTLPTraceID] = ids[0]
+			fields[kleos.OTLPSpanID] = ids[1]
+		}
+	})
+
+	ctx := context.WithValue(context.Background(), spanKey{}, [2]string{"4BF92F3577B34DA6A3CE929D0E0E4736", "00f067aa0ba902b7"})
+	log.Context(ctx).Info("traced")
+
+	assert.NoError(log.Flush(context.Background()))
+
+	record := nextExport(t, requests).ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", record.TraceID)
+	assert.Equal("00f067aa0ba902b7", record.SpanID)
+	assert.Nil(attribute(record.Attributes, kleos.OTLPTraceID))
+}
+
+func TestOTLPExportFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewOTLPExporter(server.URL+"/v1/logs", "billing"))
+
+	log.Info("lost")
+
+	assert.ErrorContains(t, log.Flush(context.Background()), "503")
+}
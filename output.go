@@ -1,10 +1,11 @@
 package kleos
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"time"
 )
 
 const (
@@ -19,6 +20,12 @@ type Writer interface {
 	Write(m Message) error
 }
 
+// Flusher is implemented by outputs that buffer messages, such as AsyncWriter.
+type Flusher interface {
+	// Flush waits for any buffered messages to be written, or for the context to be done.
+	Flush(ctx context.Context) error
+}
+
 // SetOutput changes the output writer.
 func SetOutput(out Writer) {
 	local.SetOutput(out)
@@ -26,10 +33,35 @@ func SetOutput(out Writer) {
 
 // SetOutput changes the output writer.
 func (k *Kleos) SetOutput(out Writer) {
-	k.Lock()
-	defer k.Unlock()
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
+
+	root.output = out
+}
+
+// Flush waits for the output to write any buffered messages, or for the context to be done.
+// Only outputs that implement Flusher buffer messages.
+func Flush(ctx context.Context) error {
+	return local.Flush(ctx)
+}
 
-	k.output = out
+// Flush waits for the output to write any buffered messages, or for the context to be done.
+// Only outputs that implement Flusher buffer messages.
+func (k *Kleos) Flush(ctx context.Context) error {
+	root := k.base()
+
+	root.RLock()
+	out := root.output
+	root.RUnlock()
+
+	flusher, ok := out.(Flusher)
+	if !ok {
+		return nil
+	}
+
+	return flusher.Flush(ctx)
 }
 
 // Output writes a nicely formatted message to the output device.
@@ -38,18 +70,48 @@ func (m Message) Output() {
 		return
 	}
 
+	if m.when.IsZero() {
+		m.when = time.Now()
+	}
+
+	if m.source && m.pc == nil {
+		m.pc = make([]uintptr, maxCallers)
+		m.pc = m.pc[:callers(m.pc)]
+	}
+
 	if m.source && m.skip >= 0 && m.skip < len(m.pc) {
-		frame, _ := runtime.CallersFrames(m.pc[m.skip : m.skip+1]).Next()
-		_, file, line, ok := frame.PC, frame.File, frame.Line, frame.PC != 0
-		if ok {
-			m.pkg = filepath.Base(filepath.Dir(file))
-			m.file = filepath.Base(file)
-			m.line = line
+		if pkg, file, line, ok := resolveSource(m.pc[m.skip]); ok {
+			m.pkg, m.file, m.line = pkg, file, line
 		}
 	}
 
+	if m.redactor != nil {
+		m = m.redactor.redact(m)
+	}
+
+	if m.sampler != nil && !m.sampler.sample(m, m.out) {
+		return
+	}
+
+	m.stack = m.captureStack()
+
 	if err := m.out.Write(m); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Unable to log message: %s", err)
+		reportError(err)
 		return
 	}
 }
+
+// Returns the package, source file name, and line number of the call site.
+func resolveSource(pc uintptr) (string, string, int, bool) {
+	frame := sourceFrame(pc)
+	if frame.PC == 0 {
+		return "", "", 0, false
+	}
+
+	return filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File), frame.Line, true
+}
+
+// Reports a failure to write a log message to stderr, since there's nowhere else to put it.
+func reportError(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "Unable to log message: %s\n", err)
+}
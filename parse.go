@@ -0,0 +1,728 @@
+package kleos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnrecognized is returned when parsing a line that wasn't written by the JSONOutput,
+// TextOutput, or ColorOutput.
+var ErrUnrecognized = errors.New("not a log message")
+
+// ParseError reports a line that couldn't be parsed into a message.
+type ParseError struct {
+	Line string // the line, without the trailing newline
+	Err  error  // why the line couldn't be parsed
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unable to parse %q: %s", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parser reconstructs messages from the lines written by the JSONOutput, TextOutput, and
+// ColorOutput, so they may be filtered and written to another output, e.g. to read production
+// JSON logs as color text:
+//
+//	parser := kleos.NewParser()
+//
+//	m, err := parser.Parse(line)
+//	if err != nil {
+//		return err
+//	}
+//
+//	return kleos.NewColorOutput(os.Stdout).Write(m)
+//
+// The reconstructed message has the time, level, verbosity, text, source, error, stack trace,
+// and fields of the original, as far as the output recorded them.  The error reports the
+// message and type of the original error, and of the errors it wrapped.  Numbers in the fields
+// are int64 or float64, and nested values are maps and slices, as decoded from JSON.
+//
+// Messages written by the text outputs carry less:  the error's type is unknown, and field
+// values are strings, unless they look like the numbers or booleans the text outputs write.
+type Parser struct {
+	// JSONSchema is the keys of the standard log data in JSON lines.  Dotted keys, such as the
+	// ECS `log.level`, also match nested objects, so LogstashJSONSchema parses the ECSOutput.
+	JSONSchema JSONSchema
+}
+
+// NewParser creates a parser for the JSON lines written with the DefaultJSONSchema, and for
+// text lines.
+func NewParser() *Parser {
+	return &Parser{
+		JSONSchema: DefaultJSONSchema,
+	}
+}
+
+// ParseMessage reconstructs a message from a line of JSON or text output.  See Parser.
+func ParseMessage(line []byte) (Message, error) {
+	return NewParser().Parse(line)
+}
+
+// Parse reconstructs a message from a line of JSON or text output.  JSON lines start with a
+// brace.  Returns a ParseError wrapping ErrUnrecognized if the line isn't a log message.
+func (p *Parser) Parse(line []byte) (Message, error) {
+	line = bytes.TrimRight(line, "\r\n")
+
+	trimmed := bytes.TrimLeft(line, " \t")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return p.ParseJSON(line)
+	}
+
+	return p.ParseText(line)
+}
+
+// ParseJSON reconstructs a message from a line written by the JSONOutput, using the parser's
+// JSONSchema.  Keys that aren't in the schema are the message's fields.
+func (p *Parser) ParseJSON(line []byte) (Message, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return Message{}, &ParseError{string(line), fmt.Errorf("%w: %s", ErrUnrecognized, err)}
+	}
+
+	s := p.JSONSchema
+
+	var m Message
+
+	ts, ok := takeJSON(doc, s.Timestamp).(string)
+	if !ok {
+		return Message{}, &ParseError{string(line), fmt.Errorf("%w: missing %q", ErrUnrecognized, s.Timestamp)}
+	}
+
+	when, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Message{}, &ParseError{string(line), fmt.Errorf("%w: %s", ErrUnrecognized, err)}
+	}
+	m.when = when
+
+	if name, ok := takeJSON(doc, s.Level).(string); ok {
+		m.level, _ = s.parseLevel(name)
+	}
+
+	if v, ok := jsonInt(takeJSON(doc, s.Verbosity)); ok && v > 0 && v <= math.MaxUint8 {
+		m.verbosity = uint8(v)
+	}
+
+	m.msg, _ = takeJSON(doc, s.Message).(string)
+
+	m.pkg, _ = takeJSON(doc, s.Pkg).(string)
+	m.file, _ = takeJSON(doc, s.Src).(string)
+	if n, ok := jsonInt(takeJSON(doc, s.Line)); ok {
+		m.line = int(n)
+	}
+
+	// The ECSOutput reports the package with the file, and the logger's name in place of the
+	// package
+	var logger string
+	if dir, file := path.Split(m.file); dir != "" {
+		pkg := strings.TrimSuffix(dir, "/")
+		if m.pkg != "" && m.pkg != pkg {
+			logger = m.pkg
+		}
+
+		m.pkg, m.file = pkg, file
+	}
+
+	msg, hasErr := takeJSON(doc, s.Error).(string)
+	errType, _ := takeJSON(doc, s.ErrorType).(string)
+	chain := takeJSON(doc, s.Chain)
+
+	if hasErr {
+		m.error = parseJSONError(msg, errType, chain)
+	}
+
+	m.stack = parseJSONStack(takeJSON(doc, s.Stack))
+
+	fields := Fields(doc)
+	if s.Fields != "" {
+		nested, _ := takeJSON(doc, s.Fields).(map[string]interface{})
+		fields = nested
+	}
+
+	if len(fields) > 0 {
+		m.fields = make(Fields, len(fields))
+		for k, v := range fields {
+			m.fields[k] = jsonNumbers(v)
+		}
+	}
+
+	if logger != "" {
+		if m.fields == nil {
+			m.fields = make(Fields, 1)
+		}
+
+		m.fields[LoggerField] = logger
+	}
+
+	// The output already merged the bound, error, and context fields
+	m.resolved = true
+
+	if m.level == 0 {
+		m.level = m.Level()
+	}
+
+	return m, nil
+}
+
+// Matches the color escape sequences written by the ColorOutput.  The text outputs escape any
+// other escape characters, so these are the only ones in a line.
+var colorEscapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ParseText reconstructs a message from a line written by the TextOutput or ColorOutput:
+//
+//	2024-03-09T17:04:05.000Z ERR Unable to save (billing/save.go:42), err="disk full", id=7
+//
+// The text of the message is unescaped.  Fields that follow the source, or the message if
+// there's no source, are split off at each ", key=value"; the text outputs escape anything in
+// the message itself that looks like fields or a source.
+func (p *Parser) ParseText(line []byte) (Message, error) {
+	text := string(uncolor(bytes.TrimRight(line, "\r\n")))
+
+	unrecognized := func(reason string) (Message, error) {
+		return Message{}, &ParseError{text, fmt.Errorf("%w: %s", ErrUnrecognized, reason)}
+	}
+
+	ts, rest, ok := strings.Cut(text, " ")
+	if !ok {
+		return unrecognized("missing level")
+	}
+
+	when, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return unrecognized("invalid timestamp")
+	}
+
+	// The level ends at the message, or at the fields if there's no message
+	end := strings.IndexAny(rest, " ,")
+	if end < 0 {
+		end = len(rest)
+	}
+
+	if end == 0 {
+		return unrecognized("missing level")
+	}
+
+	var m Message
+	m.when = when
+
+	switch code := rest[:end]; code {
+	case "INF":
+		m.level = InfoLevel
+	case "WRN":
+		m.level = WarnLevel
+	case "ERR":
+		m.level = ErrorLevel
+	case "FTL":
+		m.level = FatalLevel
+	default:
+		v, err := strconv.ParseUint(code[1:], 10, 8)
+		if code[0] != 'D' || len(code) < 3 || err != nil {
+			return unrecognized("invalid level " + strconv.Quote(code))
+		}
+
+		m.level = DebugLevel
+		m.verbosity = uint8(v)
+	}
+
+	rest = rest[end:]
+
+	msg, tail := splitTextTail(rest)
+	m.msg = unescapeText(strings.TrimPrefix(msg, " "))
+
+	m.pkg, m.file, m.line = tail.pkg, tail.file, tail.line
+
+	// Typed fields, so they're output in the same order
+	for _, f := range tail.fields {
+		switch {
+		case f.key == JSONError && m.error == nil:
+			m.error = &parsedError{msg: f.value}
+		case f.quoted:
+			m.typed = append(m.typed, String(f.key, f.value))
+		default:
+			m.typed = append(m.typed, Object(f.key, textValue(f.value)))
+		}
+	}
+
+	m.resolved = true
+
+	return m, nil
+}
+
+// The source and fields that follow the text of a message written by the text outputs.
+type textTail struct {
+	pkg, file string
+	line      int
+	fields    []parsedField
+}
+
+// A field parsed from a line of text output.
+type parsedField struct {
+	key    string
+	value  string // unquoted
+	quoted bool
+}
+
+// Splits the rest of a line of text output, after the level, into the message and the source
+// and fields that follow it, e.g. ` (billing/save.go:42), err="disk full", id=7`.  Scans once,
+// from the end of the line:  the text outputs escape anything in the message that looks like
+// the source or fields, so whatever is left once they're parsed is the message.
+func splitTextTail(s string) (string, textTail) {
+	var tail textTail
+
+	end := len(s)
+	for {
+		f, start, ok := lastTextField(s[:end])
+		if !ok {
+			break
+		}
+
+		tail.fields = append(tail.fields, f)
+		end = start
+	}
+
+	// Found last to first
+	for i, j := 0, len(tail.fields)-1; i < j; i, j = i+1, j-1 {
+		tail.fields[i], tail.fields[j] = tail.fields[j], tail.fields[i]
+	}
+
+	if start := strings.LastIndex(s[:end], " ("); start >= 0 {
+		if pkg, file, line, after, ok := parseTextSource(s[start+1 : end]); ok && after == "" {
+			tail.pkg, tail.file, tail.line = pkg, file, line
+			end = start
+		}
+	}
+
+	return s[:end], tail
+}
+
+// Parses the field at the end of a line of text output, e.g. `, id=7` or `, err="disk full"`,
+// returning the field and where it starts.
+func lastTextField(s string) (parsedField, int, bool) {
+	var f parsedField
+	var eq int
+
+	if strings.HasSuffix(s, `"`) {
+		open := -1
+		for i := len(s) - 2; i >= 0; i-- {
+			if s[i] == '"' && !escapedAt(s, i) {
+				open = i
+				break
+			}
+		}
+
+		if open < 1 || s[open-1] != '=' {
+			return f, 0, false
+		}
+
+		value, err := strconv.Unquote(s[open:])
+		if err != nil {
+			return f, 0, false
+		}
+
+		f.value, f.quoted = value, true
+		eq = open - 1
+	} else {
+		eq = strings.LastIndexAny(s, " =\"")
+		if eq < 0 || s[eq] != '=' || eq == len(s)-1 {
+			return f, 0, false
+		}
+
+		f.value = s[eq+1:]
+	}
+
+	// The key follows an unescaped ", "
+	space := strings.LastIndexAny(s[:eq], " \",=")
+	if space < 1 || space+1 == eq || s[space] != ' ' || s[space-1] != ',' || escapedAt(s, space-1) {
+		return f, 0, false
+	}
+
+	f.key = s[space+1 : eq]
+
+	return f, space - 1, true
+}
+
+// Is the character at i escaped with a backslash?  Backslashes escape each other, so it's
+// escaped if there are an odd number of them in front of it.
+func escapedAt(s string, i int) bool {
+	n := 0
+	for i > 0 && s[i-1] == '\\' {
+		n++
+		i--
+	}
+
+	return n%2 == 1
+}
+
+// Parses the source of a message in the text output, e.g. "(billing/save.go:42)", returning
+// the package, file, line number, and whatever follows the source.
+func parseTextSource(s string) (string, string, int, string, bool) {
+	end := strings.IndexByte(s, ')')
+	if !strings.HasPrefix(s, "(") || end < 0 {
+		return "", "", 0, s, false
+	}
+
+	source := s[1:end]
+
+	colon := strings.LastIndexByte(source, ':')
+	slash := strings.LastIndexByte(source, '/')
+	if colon < 0 || slash < 0 || slash > colon {
+		return "", "", 0, s, false
+	}
+
+	line, err := strconv.Atoi(source[colon+1:])
+	if err != nil {
+		return "", "", 0, s, false
+	}
+
+	return source[:slash], source[slash+1 : colon], line, s[end+1:], true
+}
+
+// Reverses the escaping of the log message by the text outputs, e.g. "\n" back to a newline
+// and "\," back to a comma.  See sanitizeText.
+func unescapeText(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; next {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u', 'U':
+			size := 4
+			if next == 'U' {
+				size = 8
+			}
+
+			if i+2+size > len(s) {
+				b.WriteByte(s[i])
+				continue
+			}
+
+			r, err := strconv.ParseUint(s[i+2:i+2+size], 16, 32)
+			if err != nil {
+				b.WriteByte(s[i])
+				continue
+			}
+
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			b.WriteByte(next)
+		}
+
+		i++
+	}
+
+	return b.String()
+}
+
+// Converts an unquoted value from the text output back into a number or boolean, if that's
+// how the text outputs would have written one.  Anything else, such as "007", is a string.
+func textValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "<nil>":
+		return nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		return n
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strconv.FormatFloat(f, 'f', 5, 64) == s {
+		return f
+	}
+
+	return s
+}
+
+// Returns the Level named in the JSON output, either by the schema's Levels or by the default
+// names.
+func (s JSONSchema) parseLevel(name string) (Level, bool) {
+	for level, levelName := range s.Levels {
+		if levelName == name {
+			return level, true
+		}
+	}
+
+	level, err := ParseLevel(name)
+	return level, err == nil
+}
+
+// Removes the value from the JSON document and returns it.  A dotted key, e.g. "log.level",
+// matches either the key itself or the nested objects, e.g. `{"log":{"level":"info"}}`.
+// Empty objects left behind are removed as well.
+func takeJSON(doc map[string]interface{}, key string) interface{} {
+	if key == "" {
+		return nil
+	}
+
+	if value, ok := doc[key]; ok {
+		delete(doc, key)
+		return value
+	}
+
+	parent, child, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil
+	}
+
+	nested, ok := doc[parent].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	value := takeJSON(nested, child)
+	if len(nested) == 0 {
+		delete(doc, parent)
+	}
+
+	return value
+}
+
+// Returns the integer value of a JSON number.
+func jsonInt(value interface{}) (int64, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	i, err := n.Int64()
+	return i, err == nil
+}
+
+// Converts the JSON numbers in a decoded value to int64 or float64.
+func jsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+
+		return v.String()
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = jsonNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = jsonNumbers(child)
+		}
+	}
+
+	return value
+}
+
+// Reconstructs the error from its message, type, and chain of wrapped errors.
+func parseJSONError(msg, errType string, chain interface{}) error {
+	links, _ := chain.([]interface{})
+
+	// The chain starts with the error itself
+	var wrapped error
+	for i := len(links) - 1; i > 0; i-- {
+		link, _ := links[i].(map[string]interface{})
+
+		linkMsg, _ := link["msg"].(string)
+		linkType, _ := link["type"].(string)
+
+		wrapped = &parsedError{msg: linkMsg, typ: linkType, wrapped: wrapped}
+	}
+
+	return &parsedError{msg: msg, typ: errType, wrapped: wrapped}
+}
+
+// Reconstructs the stack trace.
+func parseJSONStack(stack interface{}) []Frame {
+	calls, _ := stack.([]interface{})
+	if len(calls) == 0 {
+		return nil
+	}
+
+	frames := make([]Frame, 0, len(calls))
+	for _, call := range calls {
+		frame, _ := call.(map[string]interface{})
+
+		f := Frame{}
+		f.Func, _ = frame["func"].(string)
+		f.File, _ = frame["file"].(string)
+		if line, ok := jsonInt(frame["line"]); ok {
+			f.Line = int(line)
+		}
+
+		frames = append(frames, f)
+	}
+
+	return frames
+}
+
+// An error reconstructed from log output.  Reports the type of the original error, if known.
+type parsedError struct {
+	msg     string
+	typ     string
+	wrapped error
+}
+
+func (e *parsedError) Error() string {
+	return e.msg
+}
+
+func (e *parsedError) Unwrap() error {
+	return e.wrapped
+}
+
+// MessageReader reads the messages written by the JSONOutput, TextOutput, or ColorOutput, one
+// at a time.  Lines may be JSON or text, even mixed together.  The stack traces the text
+// outputs write beneath error messages are attached to the messages, as long as they've been
+// written by the time the message is read; the reader never waits for them.
+type MessageReader struct {
+	Parser
+
+	// Follow keeps a partial line at the end of the input, rather than parsing it, so the
+	// rest of the line may be read once it's written, e.g. when tailing a log file.  Read
+	// returns io.EOF until then.
+	Follow bool
+
+	in      *bufio.Reader
+	partial []byte
+}
+
+// NewMessageReader creates a reader that reconstructs messages from the input, using the
+// DefaultJSONSchema for JSON lines.
+func NewMessageReader(in io.Reader) *MessageReader {
+	return &MessageReader{
+		Parser: *NewParser(),
+		in:     bufio.NewReader(in),
+	}
+}
+
+// Read the next message from the input.  Returns io.EOF at the end of the input.  Lines that
+// aren't log messages, including stack traces that couldn't be attached to their message,
+// return a ParseError; keep reading to skip over them.  Blank lines are skipped.
+func (r *MessageReader) Read() (Message, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Message{}, err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		m, err := r.Parse(line)
+		if err != nil {
+			return Message{}, err
+		}
+
+		if m.error != nil && len(m.stack) == 0 {
+			m.stack = r.readStack()
+		}
+
+		return m, nil
+	}
+}
+
+// Reads a line, without the trailing newline or any color.  Partial lines at the end of the
+// input are held until the rest is written if following the input.
+func (r *MessageReader) readLine() ([]byte, error) {
+	line, err := r.in.ReadBytes('\n')
+
+	if len(r.partial) > 0 {
+		line = append(r.partial, line...)
+		r.partial = nil
+	}
+
+	if err == io.EOF && len(line) > 0 && r.Follow {
+		r.partial = line
+	}
+
+	if err != nil && (err != io.EOF || len(line) == 0 || r.Follow) {
+		return nil, err
+	}
+
+	return uncolor(bytes.TrimRight(line, "\r\n")), nil
+}
+
+// Reads the stack trace the text outputs write beneath an error message, if it's already been
+// read into the buffer:  each function call on its own line, indented, followed by the source
+// file and line indented twice.
+func (r *MessageReader) readStack() []Frame {
+	var frames []Frame
+
+	for {
+		buffered, _ := r.in.Peek(r.in.Buffered())
+
+		end := bytes.IndexByte(buffered, '\n')
+		if end < 0 {
+			return frames
+		}
+
+		line := uncolor(bytes.TrimRight(buffered[:end], "\r"))
+		if len(line) < 2 || line[0] != '\t' {
+			return frames
+		}
+
+		_, _ = r.in.Discard(end + 1)
+
+		if line[1] != '\t' {
+			frames = append(frames, Frame{Func: string(line[1:])})
+			continue
+		}
+
+		if len(frames) == 0 {
+			continue
+		}
+
+		source := string(line[2:])
+		if colon := strings.LastIndexByte(source, ':'); colon >= 0 {
+			if n, err := strconv.Atoi(source[colon+1:]); err == nil {
+				frames[len(frames)-1].File, frames[len(frames)-1].Line = source[:colon], n
+			}
+		}
+	}
+}
+
+// Removes the color escape sequences written by the ColorOutput.
+func uncolor(line []byte) []byte {
+	if bytes.IndexByte(line, 0x1b) < 0 {
+		return line
+	}
+
+	return colorEscapes.ReplaceAll(line, nil)
+}
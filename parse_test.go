@@ -0,0 +1,355 @@
+package kleos_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// Logs a variety of messages, to check that they survive the trip through an output and back.
+func logVariety(log *kleos.Kleos) {
+	id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+	wrapped := fmt.Errorf("unable to save: %w", errors.New("connection reset"))
+
+	log.Log("Hello World")
+	log.Log("")
+	log.V(3).Log("Debugging, a=b")
+	log.V(120).Log("Tracing")
+	log.V(120).Log("")
+	log.Log(`Copied C:\new\, to (backup/db.go:9)`)
+	log.Warn().Log("Running low")
+	log.With(kleos.Fields{
+		"name":    "NBC Sports",
+		"count":   42,
+		"ratio":   0.5,
+		"ok":      true,
+		"id":      id,
+		"zip":     "02134",
+		"quoted":  `say "hi", x=y`,
+		"escaped": "one\ntwo\x1b[31m",
+	}).Log("Fields")
+	log.Error(wrapped).With(kleos.Fields{"table": "users"}).Log("Unable to save")
+	log.Error(errors.New("yikes")).Warn().Log("Retrying")
+	log.Named("billing").Add(kleos.Int("rows", 3), kleos.Duration("took", time.Second)).Log("Charged")
+}
+
+// Reads every message from the input and writes it to the output.
+func rewrite(t *testing.T, in io.Reader, out kleos.Writer) {
+	reader := kleos.NewMessageReader(in)
+
+	for {
+		m, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.NoError(t, out.Write(m))
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		comment string
+		output  func(w io.Writer) kleos.Writer
+		source  bool
+	}{
+		{"json", func(w io.Writer) kleos.Writer { return kleos.NewJSONOutput(w) }, true},
+		{"json without source", func(w io.Writer) kleos.Writer { return kleos.NewJSONOutput(w) }, false},
+		{"text", func(w io.Writer) kleos.Writer { return kleos.NewTextOutput(w) }, true},
+		{"text without source", func(w io.Writer) kleos.Writer { return kleos.NewTextOutput(w) }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			var original, rewritten bytes.Buffer
+
+			log := kleos.New()
+			log.SetOutput(test.output(&original))
+			log.SetVerbosity(120)
+			log.SetStackDepth(3)
+			log.EnableSource(test.source)
+
+			logVariety(log)
+
+			assert.Contains(t, original.String(), "Tracing")
+
+			rewrite(t, bytes.NewReader(original.Bytes()), test.output(&rewritten))
+
+			assert.Equal(t, original.String(), rewritten.String())
+		})
+	}
+}
+
+func TestParseJSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	var original, rewritten bytes.Buffer
+
+	gcp := kleos.NewJSONOutput(&original)
+	gcp.JSONSchema = kleos.GCPJSONSchema
+	gcp.Fields = "payload"
+
+	log := kleos.New()
+	log.SetOutput(gcp)
+	log.SetVerbosity(4)
+
+	logVariety(log)
+
+	reader := kleos.NewMessageReader(bytes.NewReader(original.Bytes()))
+	reader.JSONSchema = gcp.JSONSchema
+
+	out := kleos.NewJSONOutput(&rewritten)
+	out.JSONSchema = gcp.JSONSchema
+
+	for {
+		m, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if !assert.NoError(err) {
+			return
+		}
+
+		assert.NoError(out.Write(m))
+	}
+
+	assert.Equal(original.String(), rewritten.String())
+}
+
+func TestParseECS(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewECSOutput("billing", &out))
+
+	log.Error(errors.New("yikes")).With(kleos.Fields{"user.id": 5}).Log("Unable to save")
+
+	parser := kleos.NewParser()
+	parser.JSONSchema = kleos.LogstashJSONSchema
+
+	m, err := parser.Parse(out.Bytes())
+	if !assert.NoError(err, out.String()) {
+		return
+	}
+
+	assert.Equal("Unable to save", m.Text())
+	assert.Equal(kleos.ErrorLevel, m.Level())
+	assert.Equal("yikes", m.Err().Error())
+	assert.Equal("kleos", m.Package())
+	assert.Equal("parse_test.go", m.File())
+	assert.Equal(map[string]interface{}{"id": int64(5)}, m.Fields()["user"])
+	assert.NotContains(m.Fields(), kleos.LoggerField)
+
+	// Named loggers report their name in place of the package
+	out.Reset()
+	log.Named("invoices").Log("Saved")
+
+	m, err = parser.Parse(out.Bytes())
+	if !assert.NoError(err, out.String()) {
+		return
+	}
+
+	assert.Equal("kleos", m.Package())
+	assert.Equal("parse_test.go", m.File())
+	assert.Equal("invoices", m.Fields()[kleos.LoggerField])
+}
+
+func TestParseText(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := kleos.ParseMessage([]byte(`2024-03-09T17:04:05.120Z D02 Saving, really (billing/save.go:42), err="disk full", count=3, ratio=0.50000, zip=02134, name="Bob Smith", none=<nil>` + "\n"))
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(time.Date(2024, 3, 9, 17, 4, 5, 120000000, time.UTC), m.Time())
+	assert.Equal(kleos.DebugLevel, m.Level())
+	assert.Equal(uint8(2), m.Verbosity())
+	assert.Equal("Saving, really", m.Text())
+	assert.Equal("billing", m.Package())
+	assert.Equal("save.go", m.File())
+	assert.Equal(42, m.Line())
+	assert.Equal("disk full", m.Err().Error())
+	assert.Equal(kleos.Fields{
+		"count": int64(3),
+		"ratio": 0.5,
+		"zip":   "02134",
+		"name":  "Bob Smith",
+		"none":  nil,
+	}, m.Fields())
+
+	// The text output doesn't record the type of the error
+	var out bytes.Buffer
+	assert.NoError(kleos.NewJSONOutput(&out).Write(m))
+	assert.Contains(out.String(), `"err":"disk full"`)
+	assert.NotContains(out.String(), "err_type")
+}
+
+func TestParseTextLongLine(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every comma could start the fields, so parsing the fields from each of them would take
+	// quadratic time
+	msg := strings.Repeat("a, b ", 100000) + "(c)"
+	line := "2024-03-09T17:04:05.120Z INF " + msg + ` (billing/save.go:42), x="y, z=1"`
+
+	m, err := kleos.ParseMessage([]byte(line))
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(msg, m.Text())
+	assert.Equal("save.go", m.File())
+	assert.Equal(kleos.Fields{"x": "y, z=1"}, m.Fields())
+}
+
+func TestParseTextEscaping(t *testing.T) {
+	for _, msg := range []string{
+		`Copied C:\new\, to (backup/db.go:9)`,
+		"Signed in, admin=true",
+		"Signed in (auth/admin.go:1)",
+		"one\ntwo\t\x1b[31m\u2028three",
+		`literal \n and \u0041`,
+	} {
+		var out bytes.Buffer
+
+		log := kleos.New()
+		log.SetOutput(kleos.NewTextOutput(&out))
+		log.EnableSource(false)
+		log.Log(msg)
+
+		m, err := kleos.ParseMessage(out.Bytes())
+		if assert.NoError(t, err, out.String()) {
+			assert.Equal(t, msg, m.Text())
+			assert.Empty(t, m.Fields(), out.String())
+			assert.Empty(t, m.File(), out.String())
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+
+	var colored, plain bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.Tee(kleos.NewColorOutput(&colored), kleos.NewTextOutput(&plain)))
+	log.SetStackDepth(2)
+
+	logVariety(log)
+
+	assert.Contains(t, colored.String(), "\x1b[")
+
+	var rewritten bytes.Buffer
+	rewrite(t, bytes.NewReader(colored.Bytes()), kleos.NewTextOutput(&rewritten))
+
+	assert.Equal(t, plain.String(), rewritten.String())
+}
+
+func TestParseUnrecognized(t *testing.T) {
+	for _, line := range []string{
+		"Hello World",
+		"2024-03-09 INF Hello",
+		"2024-03-09T17:04:05.000Z INFO Hello",
+		"2024-03-09T17:04:05.000Z XYZ Hello",
+		"2024-03-09T17:04:05.000Z D256 Hello",
+		"2024-03-09T17:04:05.000Z D5 Hello",
+		"2024-03-09T17:04:05.000Z  Hello",
+		`{"msg": "no timestamp"}`,
+		`{"ts": "2024-03-09T17:04:05.000Z"`,
+	} {
+		_, err := kleos.ParseMessage([]byte(line))
+		assert.True(t, errors.Is(err, kleos.ErrUnrecognized), line)
+
+		var parseErr *kleos.ParseError
+		if assert.True(t, errors.As(err, &parseErr)) {
+			assert.Equal(t, line, parseErr.Line)
+		}
+	}
+}
+
+func TestMessageReaderSkipsInvalidLines(t *testing.T) {
+	assert := assert.New(t)
+
+	in := strings.NewReader("panic: oops\n\n\tgoroutine 1\n" +
+		"2024-03-09T17:04:05.000Z INF Hello\n" +
+		`{"ts":"2024-03-09T17:04:06.000Z","level":"info","msg":"World"}`)
+
+	reader := kleos.NewMessageReader(in)
+
+	_, err := reader.Read()
+	assert.True(errors.Is(err, kleos.ErrUnrecognized))
+
+	// Stack traces without an error message to attach them to
+	_, err = reader.Read()
+	assert.True(errors.Is(err, kleos.ErrUnrecognized))
+
+	m, err := reader.Read()
+	assert.NoError(err)
+	assert.Equal("Hello", m.Text())
+
+	// The last line doesn't need a newline
+	m, err = reader.Read()
+	assert.NoError(err)
+	assert.Equal("World", m.Text())
+
+	_, err = reader.Read()
+	assert.Equal(io.EOF, err)
+}
+
+func TestMessageReaderFollow(t *testing.T) {
+	assert := assert.New(t)
+
+	var in bytes.Buffer
+
+	reader := kleos.NewMessageReader(&in)
+	reader.Follow = true
+
+	in.WriteString("2024-03-09T17:04:05.000Z INF Hel")
+
+	_, err := reader.Read()
+	assert.Equal(io.EOF, err)
+
+	in.WriteString("lo World, count=3\n")
+
+	m, err := reader.Read()
+	assert.NoError(err)
+	assert.Equal("Hello World", m.Text())
+	assert.Equal(int64(3), m.Fields()["count"])
+
+	_, err = reader.Read()
+	assert.Equal(io.EOF, err)
+}
+
+func TestTimeRange(t *testing.T) {
+	var out bytes.Buffer
+
+	in := strings.NewReader(`2024-03-09T17:00:00.000Z INF one
+2024-03-09T18:00:00.000Z INF two
+2024-03-09T19:00:00.000Z INF three
+`)
+
+	since := time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 3, 9, 19, 0, 0, 0, time.UTC)
+
+	rewrite(t, in, kleos.NewMultiWriter().Add(kleos.NewTextOutput(&out), kleos.TimeRange(since, until)))
+
+	assert.Equal(t, "2024-03-09T18:00:00.000Z INF two\n", out.String())
+}
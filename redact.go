@@ -0,0 +1,560 @@
+package kleos
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RedactedMask replaces values masked by a Redactor.
+const RedactedMask = "[REDACTED]"
+
+// ErrInvalidRedactRule is returned by NewRedactor if a rule's key pattern is malformed or its
+// value pattern is missing.
+var ErrInvalidRedactRule = errors.New("invalid redaction rule")
+
+// Patterns for the common kinds of sensitive values.  If a pattern has a capture group, only
+// the text matching the group is redacted, e.g. the token following "Bearer".
+var (
+	EmailPattern       = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	CreditCardPattern  = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+	JWTPattern         = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	BearerTokenPattern = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)
+)
+
+// Redactable is implemented by types that redact themselves, such as a user record that
+// leaves out the user's personal details.  When a Redactor processes a field holding a
+// Redactable, the field's value is replaced by the result of Redact before any other rules
+// apply.
+type Redactable interface {
+	Redact() any
+}
+
+// RedactStrategy is how a Redactor hides a sensitive value.
+type RedactStrategy uint8
+
+const (
+	// RedactMask replaces the value with RedactedMask.
+	RedactMask RedactStrategy = iota
+
+	// RedactHash replaces the value with a hash of it, so messages about the same value may
+	// still be correlated without revealing it.  See Redactor.Salt.
+	RedactHash
+
+	// RedactDrop removes the field.  Sensitive values in the log message itself are removed
+	// from the text.
+	RedactDrop
+)
+
+// RedactRule is a rule for a Redactor, created with RedactKey, RedactValue, and so on.
+type RedactRule struct {
+	strategy RedactStrategy
+	key      string                  // glob pattern for field names
+	fold     bool                    // match the key case-insensitively
+	value    *regexp.Regexp          // pattern for sensitive values
+	valid    func(match string) bool // confirms a value matches, e.g. a credit card checksum
+}
+
+// RedactKey creates a rule for the fields with the given name.  The name may be a glob
+// pattern, e.g. "*_token"; see path.Match.  The name is case-sensitive.  Values nested in a
+// field, such as the keys of a map or the fields of a struct, match by their own name or by
+// their dotted path, e.g. "email" or "user.email".
+func RedactKey(pattern string, strategy RedactStrategy) RedactRule {
+	return RedactRule{key: pattern, strategy: strategy}
+}
+
+// RedactKeyFold creates a rule for the fields with the given name, ignoring case, so "email"
+// also matches "Email" and "EMAIL".  The name may be a glob pattern.
+func RedactKeyFold(pattern string, strategy RedactStrategy) RedactRule {
+	return RedactRule{key: strings.ToLower(pattern), fold: true, strategy: strategy}
+}
+
+// RedactValue creates a rule for any text matching the pattern, in field values, the log
+// message, and the error message.  Field values that aren't text, such as numbers, aren't
+// checked.
+func RedactValue(pattern *regexp.Regexp, strategy RedactStrategy) RedactRule {
+	return RedactRule{value: pattern, strategy: strategy}
+}
+
+// RedactEmails creates a rule for email addresses.
+func RedactEmails(strategy RedactStrategy) RedactRule {
+	return RedactValue(EmailPattern, strategy)
+}
+
+// RedactCreditCards creates a rule for credit card numbers.  Only numbers with a valid Luhn
+// checksum are redacted, so most other long numbers aren't.
+func RedactCreditCards(strategy RedactStrategy) RedactRule {
+	rule := RedactValue(CreditCardPattern, strategy)
+	rule.valid = luhn
+
+	return rule
+}
+
+// RedactJWTs creates a rule for JSON Web Tokens.
+func RedactJWTs(strategy RedactStrategy) RedactRule {
+	return RedactValue(JWTPattern, strategy)
+}
+
+// RedactBearerTokens creates a rule for bearer tokens, e.g. in an Authorization header.
+func RedactBearerTokens(strategy RedactStrategy) RedactRule {
+	return RedactValue(BearerTokenPattern, strategy)
+}
+
+// Does the field name match the rule?
+func (rule RedactRule) matchKey(key string) bool {
+	if rule.value != nil {
+		return false
+	}
+
+	if rule.fold {
+		key = strings.ToLower(key)
+	}
+
+	matched, _ := path.Match(rule.key, key)
+	return matched
+}
+
+// Redactor hides sensitive values in log messages before they're output:  fields whose names
+// match a key rule, text matching a value rule, and values that implement Redactable.  Key
+// rules are checked first, in order, and the first one that matches applies.  Every value rule
+// is then applied to what's left.  Values nested in fields, such as maps, slices, and structs,
+// are checked the same way.
+//
+// Attach a redactor to a logger with SetRedactor, or wrap an output with Wrap to redact only the
+// messages sent to that output, e.g. redacting the messages sent to Logstash but not those sent
+// to the console during development.
+type Redactor struct {
+	// Salt is mixed into the hashes of RedactHash rules, so the hashes can't be reversed by
+	// hashing likely values.  Set it before logging.
+	Salt string
+
+	keys   []RedactRule
+	values []RedactRule
+}
+
+// NewRedactor creates a redactor that applies the rules.  Returns ErrInvalidRedactRule if a
+// rule is malformed.
+//
+//	redactor, err := kleos.NewRedactor(
+//		kleos.RedactKeyFold("password", kleos.RedactDrop),
+//		kleos.RedactKeyFold("*token*", kleos.RedactMask),
+//		kleos.RedactEmails(kleos.RedactHash),
+//	)
+func NewRedactor(rules ...RedactRule) (*Redactor, error) {
+	r := &Redactor{}
+
+	for _, rule := range rules {
+		if rule.value != nil {
+			r.values = append(r.values, rule)
+			continue
+		}
+
+		if _, err := path.Match(rule.key, ""); err != nil || rule.key == "" {
+			return nil, fmt.Errorf("%w: key %q", ErrInvalidRedactRule, rule.key)
+		}
+
+		r.keys = append(r.keys, rule)
+	}
+
+	return r, nil
+}
+
+// SetRedactor redacts the messages output by the global logger.  Set the redactor to nil to
+// output messages as they are.
+func SetRedactor(r *Redactor) {
+	local.SetRedactor(r)
+}
+
+// SetRedactor redacts the messages output by the logger and any loggers derived from it.  Set
+// the redactor to nil to output messages as they are.
+func (k *Kleos) SetRedactor(r *Redactor) {
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
+
+	root.redactor = r
+}
+
+// Wrap returns an output that redacts the messages written to it before passing them on to
+// out.
+func (r *Redactor) Wrap(out Writer) *RedactedWriter {
+	return &RedactedWriter{
+		redactor: r,
+		out:      out,
+	}
+}
+
+// Redacts the message's text, error, and fields.  The fields are resolved, so context values,
+// bound fields, and the error's fields are redacted too.
+func (r *Redactor) redact(m Message) Message {
+	if !m.resolved {
+		m.base = m.boundFields()
+		m.errFields = m.ErrorFields()
+	}
+
+	m.msg, _ = r.redactText(m.msg)
+	m.error, _ = r.redactError(m.error)
+
+	typed := make([]Field, 0, len(m.typed))
+	for _, f := range m.typed {
+		value, keep, changed := r.redactField(f.Key, f.Value())
+		if !keep {
+			continue
+		}
+
+		if changed {
+			f = Object(f.Key, value)
+		}
+
+		typed = append(typed, f)
+	}
+
+	m.base = r.redactFields(m.base)
+	m.errFields = r.redactFields(m.errFields)
+	m.fields = r.redactFields(m.fields)
+	m.typed = typed
+	m.resolved = true
+
+	return m
+}
+
+// Returns a redacted copy of the fields, or nil if there aren't any.
+func (r *Redactor) redactFields(fields Fields) Fields {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	redacted := make(Fields, len(fields))
+
+	for key, value := range fields {
+		if value, keep, _ := r.redactField(key, value); keep {
+			redacted[key] = value
+		}
+	}
+
+	return redacted
+}
+
+// Redacts a field's value.  Reports whether to keep the field, and whether the value changed.
+func (r *Redactor) redactField(key string, value any) (any, bool, bool) {
+	return r.redactNested(key, key, value)
+}
+
+// Redacts a field's value, or a value nested in it, such as a map or struct.  The key is the
+// value's own name, and the path its dotted path from the field, e.g. "user.email"; key rules
+// match either.  Reports whether to keep the value, and whether it changed.
+func (r *Redactor) redactNested(path, key string, value any) (any, bool, bool) {
+	var changed bool
+
+	if redactable, ok := value.(Redactable); ok && !nilPointer(redactable) {
+		value = redactable.Redact()
+		changed = true
+	}
+
+	for _, rule := range r.keys {
+		if !rule.matchKey(key) && (path == key || !rule.matchKey(path)) {
+			continue
+		}
+
+		switch rule.strategy {
+		case RedactDrop:
+			return nil, false, true
+		case RedactHash:
+			return r.hash(encodePlain(value)), true, true
+		default:
+			return RedactedMask, true, true
+		}
+	}
+
+	var text string
+
+	switch v := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, json.Number:
+		return value, true, changed
+	case string:
+		text = v
+	case error:
+		if nilPointer(v) {
+			return value, true, changed
+		}
+		text = v.Error()
+	case fmt.Stringer:
+		if nilPointer(v) {
+			return value, true, changed
+		}
+		text = v.String()
+	case map[string]any:
+		return r.redactMap(path, value, v, changed)
+	case Fields:
+		return r.redactMap(path, value, v, changed)
+	case []any:
+		return r.redactSlice(path, key, value, v, changed)
+	default:
+		// Structs, typed maps and slices, and so on are checked in their JSON form
+		generic, ok := decodeJSON(value)
+		if !ok {
+			return value, true, changed
+		}
+
+		redacted, keep, redactedChanged := r.redactNested(path, key, generic)
+		if !redactedChanged {
+			return value, true, changed
+		}
+
+		return redacted, keep, true
+	}
+
+	redacted, dropped, matched := r.redactValue(text)
+	if dropped {
+		return nil, false, true
+	}
+
+	if matched {
+		return redacted, true, true
+	}
+
+	return value, true, changed
+}
+
+// Redacts the values in a map.  Returns the original value if nothing was redacted.
+func (r *Redactor) redactMap(path string, original any, values map[string]any, changed bool) (any, bool, bool) {
+	redacted := make(map[string]any, len(values))
+
+	for key, value := range values {
+		value, keep, valueChanged := r.redactNested(path+"."+key, key, value)
+		if keep {
+			redacted[key] = value
+		}
+
+		changed = changed || valueChanged
+	}
+
+	if !changed {
+		return original, true, false
+	}
+
+	return redacted, true, true
+}
+
+// Redacts the values in a slice.  Elements are checked against the key rules as the slice
+// itself.  Returns the original value if nothing was redacted.
+func (r *Redactor) redactSlice(path, key string, original any, values []any, changed bool) (any, bool, bool) {
+	redacted := make([]any, 0, len(values))
+
+	for _, value := range values {
+		value, keep, valueChanged := r.redactNested(path, key, value)
+		if keep {
+			redacted = append(redacted, value)
+		}
+
+		changed = changed || valueChanged
+	}
+
+	if !changed {
+		return original, true, false
+	}
+
+	return redacted, true, true
+}
+
+// Applies the value rules to the text.  Text matching a RedactDrop rule is removed.
+func (r *Redactor) redactText(text string) (string, bool) {
+	redacted, _, changed := r.redactValue(text)
+	return redacted, changed
+}
+
+// Applies the value rules to the text.  Reports if any of the text matched a RedactDrop rule,
+// and if the text was changed.
+func (r *Redactor) redactValue(text string) (string, bool, bool) {
+	var dropped, changed bool
+
+	for _, rule := range r.values {
+		indexes := rule.value.FindAllStringSubmatchIndex(text, -1)
+		if indexes == nil {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+
+		for _, loc := range indexes {
+			start, end := loc[0], loc[1]
+
+			// Only redact the capture group, if there is one
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+
+			if rule.valid != nil && !rule.valid(text[start:end]) {
+				continue
+			}
+
+			b.WriteString(text[last:start])
+			b.WriteString(r.replace(rule.strategy, text[start:end]))
+			last = end
+
+			changed = true
+			dropped = dropped || rule.strategy == RedactDrop
+		}
+
+		if last > 0 {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+
+	return text, dropped, changed
+}
+
+// Returns what replaces the sensitive value.
+func (r *Redactor) replace(strategy RedactStrategy, value string) string {
+	switch strategy {
+	case RedactDrop:
+		return ""
+	case RedactHash:
+		return r.hash(value)
+	default:
+		return RedactedMask
+	}
+}
+
+// Hashes the value with the salt, e.g. "[hash:6b86b273ff34fce1]".
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(r.Salt))
+	mac.Write([]byte(value))
+
+	return "[hash:" + hex.EncodeToString(mac.Sum(nil)[:8]) + "]"
+}
+
+// Redacts the error's message and the messages of the errors it wraps.  Errors that don't need
+// redacting are returned as is.  Reports whether the error was redacted.
+func (r *Redactor) redactError(err error) (error, bool) {
+	if err == nil {
+		return err, false
+	}
+
+	var wrapped []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if child := e.Unwrap(); child != nil {
+			wrapped = []error{child}
+		}
+	case interface{ Unwrap() []error }:
+		wrapped = e.Unwrap()
+	}
+
+	msg, changed := r.redactText(err.Error())
+
+	redacted := make([]error, len(wrapped))
+	for i, child := range wrapped {
+		var childChanged bool
+		redacted[i], childChanged = r.redactError(child)
+		changed = changed || childChanged
+	}
+
+	if !changed {
+		return err, false
+	}
+
+	re := &redactedError{err: err, msg: msg, wrapped: redacted}
+
+	if fielder, ok := err.(LogFielder); ok {
+		re.fields = make(Fields)
+		for key, value := range fielder.LogFields() {
+			if value, keep, _ := r.redactField(key, value); keep {
+				re.fields[key] = value
+			}
+		}
+	}
+
+	return re, true
+}
+
+// An error with sensitive details redacted from its message.  Reports the type and stack trace
+// of the original error, and errors.Is and errors.As see through it to the original error,
+// though As returns the original, unredacted error.
+type redactedError struct {
+	err     error
+	msg     string
+	wrapped []error
+	fields  Fields
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() []error {
+	return e.wrapped
+}
+
+func (e *redactedError) LogFields() Fields {
+	return e.fields
+}
+
+func (e *redactedError) StackTrace() []uintptr {
+	return errorStack(e.err)
+}
+
+func (e *redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+func (e *redactedError) As(target any) bool {
+	return errors.As(e.err, target)
+}
+
+// Does the number pass the Luhn checksum used by credit cards?  Ignores spaces and dashes.
+func luhn(number string) bool {
+	var sum, digits int
+
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		digits++
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
+
+// RedactedWriter is an output that redacts messages before passing them on to another output.
+// Create one with Redactor.Wrap.
+type RedactedWriter struct {
+	redactor *Redactor
+	out      Writer
+}
+
+// Write the redacted message to the wrapped output.
+func (w *RedactedWriter) Write(m Message) error {
+	return w.out.Write(w.redactor.redact(m))
+}
+
+// Flush the wrapped output, if it buffers messages.
+func (w *RedactedWriter) Flush(ctx context.Context) error {
+	if flusher, ok := w.out.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package kleos
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ArchiveTimeFormat is the format of the timestamp added to the names of rotated log files.
+// Avoids colons so the names are safe on every file system.
+const ArchiveTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFileWriter is an io.Writer that writes to a log file, rotating the file when it gets
+// too big or too old.  Use it as the output of any of the Kleos outputs:
+//
+//	file := kleos.NewRotatingFileWriter("/var/log/app.log")
+//	file.MaxSize = 100 << 20
+//	file.MaxBackups = 7
+//	kleos.SetOutput(kleos.NewJSONOutput(file))
+//
+// Rotated files are renamed with a timestamp, e.g. app-2006-01-02T15-04-05.000.log, and
+// optionally compressed with gzip.  Old files may be pruned by count or age.  Compressing and
+// pruning happen in the background.
+//
+// For compatibility with logrotate, call Reopen, or ReopenOnSignal to reopen the log file when
+// the process receives a SIGHUP.
+//
+// Configure the RotatingFileWriter before writing to it.
+type RotatingFileWriter struct {
+	Filename   string           // the log file
+	MaxSize    int64            // rotate before the file exceeds this many bytes; zero for no limit
+	Interval   time.Duration    // rotate each time this interval passes, in UTC; zero to disable
+	Compress   bool             // gzip rotated files
+	MaxBackups int              // rotated files to keep; zero keeps them all
+	MaxAge     time.Duration    // delete rotated files older than this; zero keeps them all
+	Now        func() time.Time // the current time; defaults to time.Now
+
+	mutex   sync.Mutex
+	file    *os.File
+	size    int64     // bytes written to the current file
+	started time.Time // when the current file was last written, for interval rotation
+	signals chan os.Signal
+	closed  bool // stops reopening the file on a signal already received
+
+	mill sync.Mutex     // serializes compressing and pruning rotated files
+	wg   sync.WaitGroup // waits for compressing and pruning to finish
+}
+
+// NewRotatingFileWriter creates a writer for the log file.  The file is created or appended to
+// on the first write.  By default the file isn't rotated; set MaxSize or Interval.
+func NewRotatingFileWriter(filename string) *RotatingFileWriter {
+	return &RotatingFileWriter{
+		Filename: filename,
+	}
+}
+
+// Write the bytes to the log file, rotating it first if necessary.
+func (w *RotatingFileWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.due(len(b)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	w.started = w.now()
+
+	return n, err
+}
+
+// Rotate the log file now, regardless of its size or age.
+func (w *RotatingFileWriter) Rotate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	return w.rotate()
+}
+
+// Reopen closes and reopens the log file, e.g. after logrotate has moved it.  Returns
+// ErrWriterClosed if the writer has been closed.
+func (w *RotatingFileWriter) Reopen() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+
+	return w.open()
+}
+
+// ReopenOnSignal reopens the log file whenever the process receives one of the signals, or
+// SIGHUP if no signals are given.  Stops when the writer is closed.
+func (w *RotatingFileWriter) ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	if w.signals != nil {
+		signal.Stop(w.signals)
+		close(w.signals)
+	}
+
+	w.signals = make(chan os.Signal, 1)
+	signal.Notify(w.signals, sigs...)
+
+	go func(signals chan os.Signal) {
+		for range signals {
+			// A signal received as the writer was closed
+			if err := w.Reopen(); err != nil && !errors.Is(err, ErrWriterClosed) {
+				reportError(err)
+			}
+		}
+	}(w.signals)
+}
+
+// Close the log file, and wait for any rotated files to be compressed and pruned.  Stops
+// reopening the log file on a signal; see ReopenOnSignal.
+func (w *RotatingFileWriter) Close() error {
+	w.mutex.Lock()
+
+	w.closed = true
+
+	if w.signals != nil {
+		signal.Stop(w.signals)
+		close(w.signals)
+		w.signals = nil
+	}
+
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+
+	w.mutex.Unlock()
+
+	w.wg.Wait()
+
+	return err
+}
+
+// Returns the current time.
+func (w *RotatingFileWriter) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+
+	return time.Now()
+}
+
+// Opens the log file for appending.  Must be called with the mutex held.
+func (w *RotatingFileWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Filename), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.started = w.now()
+
+	// Existing log files rotate based on when they were last written
+	if w.size > 0 {
+		w.started = info.ModTime()
+	}
+
+	return nil
+}
+
+// Is it time to rotate the log file, before writing n bytes to it?  Must be called with the
+// mutex held.
+func (w *RotatingFileWriter) due(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+
+	if w.MaxSize > 0 && w.size+int64(n) > w.MaxSize {
+		return true
+	}
+
+	if w.Interval > 0 && !w.now().UTC().Truncate(w.Interval).Equal(w.started.UTC().Truncate(w.Interval)) {
+		return true
+	}
+
+	return false
+}
+
+// Renames the log file with a timestamp and starts a new one.  Must be called with the mutex
+// held.
+func (w *RotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	now := w.now()
+
+	archive := w.archiveName(now)
+	if err := os.Rename(w.Filename, archive); err != nil {
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go w.cleanup(archive, now)
+
+	return nil
+}
+
+// Returns the name of a rotated log file, e.g. "app-2006-01-02T15-04-05.000.log".  If the
+// name is taken, a counter is added.
+func (w *RotatingFileWriter) archiveName(when time.Time) string {
+	prefix, ext := w.archiveParts()
+	stamp := when.UTC().Format(ArchiveTimeFormat)
+
+	name := prefix + stamp + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s%s.%d%s", prefix, stamp, i, ext)
+	}
+
+	return name
+}
+
+// Returns the path and name prefix of the rotated log files, e.g. "/var/log/app-", and the
+// file extension, e.g. ".log".
+func (w *RotatingFileWriter) archiveParts() (string, string) {
+	ext := filepath.Ext(w.Filename)
+	return strings.TrimSuffix(w.Filename, ext) + "-", ext
+}
+
+// Compresses the rotated log file, if requested, then prunes old log files, based on when the
+// file was rotated.
+func (w *RotatingFileWriter) cleanup(archive string, now time.Time) {
+	defer w.wg.Done()
+
+	w.mill.Lock()
+	defer w.mill.Unlock()
+
+	if w.Compress {
+		if err := compress(archive); err != nil {
+			reportError(err)
+		}
+	}
+
+	if err := w.prune(now); err != nil {
+		reportError(err)
+	}
+}
+
+// Deletes rotated log files beyond MaxBackups or older than MaxAge.
+func (w *RotatingFileWriter) prune(now time.Time) error {
+	if w.MaxBackups <= 0 && w.MaxAge <= 0 {
+		return nil
+	}
+
+	prefix, ext := w.archiveParts()
+
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return err
+	}
+
+	type archive struct {
+		path string
+		when time.Time
+	}
+
+	var archives []archive
+	for _, path := range matches {
+		stamp := strings.TrimPrefix(path, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp = strings.TrimSuffix(stamp, ext)
+
+		// Ignore any counter added to the name
+		if len(stamp) > len(ArchiveTimeFormat) {
+			stamp = stamp[:len(ArchiveTimeFormat)]
+		}
+
+		when, err := time.Parse(ArchiveTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+
+		archives = append(archives, archive{path: path, when: when})
+	}
+
+	// Newest first
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].when.Equal(archives[j].when) {
+			return archives[i].path > archives[j].path
+		}
+		return archives[i].when.After(archives[j].when)
+	})
+
+	cutoff := now.Add(-w.MaxAge)
+
+	for i, a := range archives {
+		if (w.MaxBackups > 0 && i >= w.MaxBackups) || (w.MaxAge > 0 && a.when.Before(cutoff)) {
+			if err := os.Remove(a.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Gzips the file, replacing it with a ".gz" file.
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+
+	if _, err := io.Copy(gz, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	_ = in.Close()
+
+	return os.Remove(path)
+}
+
+// Does the file exist?
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
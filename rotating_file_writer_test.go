@@ -0,0 +1,215 @@
+package kleos_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// A clock for testing that only moves when told to.
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Returns the names of the files in the directory, sorted.
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func newTestRotatingFileWriter(t *testing.T) (*kleos.RotatingFileWriter, *fakeClock, string) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+
+	w := kleos.NewRotatingFileWriter(filepath.Join(dir, "app.log"))
+	w.Now = clock.Now
+
+	return w, clock, dir
+}
+
+func TestRotateOnSize(t *testing.T) {
+	assert := assert.New(t)
+
+	w, clock, dir := newTestRotatingFileWriter(t)
+	w.MaxSize = 10
+
+	_, _ = io.WriteString(w, "line 1\n")
+	_, _ = io.WriteString(w, "line 2\n") // rotates first
+	clock.Advance(time.Second)
+	_, _ = io.WriteString(w, "line 3\n") // rotates first
+
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{
+		"app-2024-03-01T23-59-00.000.log",
+		"app-2024-03-01T23-59-01.000.log",
+		"app.log",
+	}, listDir(t, dir))
+
+	assert.Equal("line 1\n", readFile(t, filepath.Join(dir, "app-2024-03-01T23-59-00.000.log")))
+	assert.Equal("line 2\n", readFile(t, filepath.Join(dir, "app-2024-03-01T23-59-01.000.log")))
+	assert.Equal("line 3\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotateOnInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	w, clock, dir := newTestRotatingFileWriter(t)
+	w.Interval = 24 * time.Hour
+
+	_, _ = io.WriteString(w, "yesterday\n")
+	clock.Advance(30 * time.Second)
+	_, _ = io.WriteString(w, "yesterday\n")
+	clock.Advance(time.Minute) // past midnight
+	_, _ = io.WriteString(w, "today\n")
+
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{"app-2024-03-02T00-00-30.000.log", "app.log"}, listDir(t, dir))
+	assert.Equal("yesterday\nyesterday\n", readFile(t, filepath.Join(dir, "app-2024-03-02T00-00-30.000.log")))
+	assert.Equal("today\n", readFile(t, filepath.Join(dir, "app.log")))
+}
+
+func TestRotateCompress(t *testing.T) {
+	assert := assert.New(t)
+
+	w, _, dir := newTestRotatingFileWriter(t)
+	w.Compress = true
+
+	_, _ = io.WriteString(w, "compress me\n")
+	assert.NoError(w.Rotate())
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{"app-2024-03-01T23-59-00.000.log.gz", "app.log"}, listDir(t, dir))
+
+	file, err := os.Open(filepath.Join(dir, "app-2024-03-01T23-59-00.000.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := io.ReadAll(gz)
+	assert.Equal("compress me\n", string(b))
+}
+
+func TestRotateMaxBackups(t *testing.T) {
+	assert := assert.New(t)
+
+	w, clock, dir := newTestRotatingFileWriter(t)
+	w.MaxBackups = 2
+
+	for i := 0; i < 4; i++ {
+		_, _ = io.WriteString(w, "line\n")
+		assert.NoError(w.Rotate())
+		clock.Advance(time.Minute)
+	}
+
+	assert.NoError(w.Close())
+
+	assert.Equal([]string{
+		"app-2024-03-02T00-01-00.000.log",
+		"app-2024-03-02T00-02-00.000.log",
+		"app.log",
+	}, listDir(t, dir))
+}
+
+func TestRotateMaxAge(t *testing.T) {
+	assert := assert.New(t)
+
+	w, clock, dir := newTestRotatingFileWriter(t)
+	w.MaxAge = 48 * time.Hour
+
+	for i := 0; i < 4; i++ {
+		_, _ = io.WriteString(w, "line\n")
+		assert.NoError(w.Rotate())
+		clock.Advance(24 * time.Hour)
+	}
+
+	assert.NoError(w.Close())
+
+	// The last rotation happened at 2024-03-04, so anything before 2024-03-03 is gone
+	assert.Equal([]string{
+		"app-2024-03-02T23-59-00.000.log",
+		"app-2024-03-03T23-59-00.000.log",
+		"app-2024-03-04T23-59-00.000.log",
+		"app.log",
+	}, listDir(t, dir))
+}
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+
+	w, _, dir := newTestRotatingFileWriter(t)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(w))
+
+	log.Log("Before")
+
+	// Simulate logrotate moving the file
+	assert.NoError(os.Rename(filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1")))
+	assert.NoError(w.Reopen())
+
+	log.Log("After")
+	assert.NoError(w.Close())
+
+	assert.Contains(readFile(t, filepath.Join(dir, "app.log.1")), " Before ")
+	assert.NotContains(readFile(t, filepath.Join(dir, "app.log.1")), " After ")
+	assert.Contains(readFile(t, filepath.Join(dir, "app.log")), " After ")
+
+	// A signal received as the writer closes doesn't reopen the file
+	assert.NoError(os.Rename(filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.2")))
+	assert.ErrorIs(w.Reopen(), kleos.ErrWriterClosed)
+	assert.NoFileExists(filepath.Join(dir, "app.log"))
+}
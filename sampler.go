@@ -0,0 +1,264 @@
+package kleos
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultSampleInterval is the sampling interval used when NewSampler is given an interval of
+// zero or less.
+const DefaultSampleInterval = time.Second
+
+// Sampler limits how often the same log message is output, so a noisy call site in a tight
+// loop doesn't flood the logs.  Messages are grouped by their text, source, and level.  In
+// each interval, the first messages in a group are output, then only every Mth message after
+// that; see NewSampler.  Fatal messages are never sampled.
+//
+// Attach a sampler to a logger with SetSampler, or wrap an output with Wrap, e.g. to sample
+// only the messages sent to one output of a MultiWriter.  Messages are grouped by their
+// source only if the logger includes the source; see EnableSource.
+//
+// Each call site that had messages suppressed periodically outputs a warning summarizing the
+// number of suppressed messages:  "Suppressed log messages", with the source of the call site,
+// the sampled message as the "sampled" field, and the number of messages suppressed as the
+// "suppressed" field.
+type Sampler struct {
+	interval   time.Duration
+	first      uint64
+	thereafter uint64
+
+	mutex      sync.Mutex
+	sites      map[sampleKey]*sampleSite
+	suppressed uint64      // total messages suppressed
+	swept      time.Time   // when expired call sites were last cleaned up
+	timer      *time.Timer // reports suppressed messages
+}
+
+// Groups messages for sampling.
+type sampleKey struct {
+	msg   string
+	pkg   string
+	file  string
+	line  int
+	level Level
+}
+
+// Tracks the messages from a call site in the current interval.
+type sampleSite struct {
+	start      time.Time // when the current interval started
+	count      uint64    // messages this interval
+	suppressed uint64    // messages suppressed since the last summary
+	summary    Message   // the summary to output, with the call site's source
+	out        Writer    // where to output the summary
+}
+
+// NewSampler creates a sampler that outputs the first messages from each call site in every
+// interval, then every thereafter'th message after that.  If thereafter is zero, the rest of
+// the messages in the interval are suppressed.
+//
+// For example, NewSampler(time.Second, 10, 100) outputs the first 10 messages each second,
+// then every 100th message.  An interval of zero or less uses DefaultSampleInterval.
+func NewSampler(interval time.Duration, first, thereafter int) *Sampler {
+	if interval <= 0 {
+		interval = DefaultSampleInterval
+	}
+
+	if first < 0 {
+		first = 0
+	}
+
+	if thereafter < 0 {
+		thereafter = 0
+	}
+
+	return &Sampler{
+		interval:   interval,
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+		sites:      make(map[sampleKey]*sampleSite),
+		swept:      time.Now(),
+	}
+}
+
+// SetSampler samples the messages output by the global logger.  Set the sampler to nil to
+// output every message.
+func SetSampler(s *Sampler) {
+	local.SetSampler(s)
+}
+
+// SetSampler samples the messages output by the logger and any loggers derived from it.  Set
+// the sampler to nil to output every message.
+func (k *Kleos) SetSampler(s *Sampler) {
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
+
+	root.sampler = s
+}
+
+// Wrap returns an output that samples the messages written to it before passing them on to
+// out.  Summaries of suppressed messages are written to out as well.
+func (s *Sampler) Wrap(out Writer) *SampledWriter {
+	return &SampledWriter{
+		sampler: s,
+		out:     out,
+	}
+}
+
+// Suppressed returns the total number of messages suppressed by the sampler.
+func (s *Sampler) Suppressed() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.suppressed
+}
+
+// Summarize outputs the summaries of any suppressed messages now, rather than waiting for the
+// end of the interval.
+func (s *Sampler) Summarize() {
+	s.mutex.Lock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	var summaries []Message
+	var outs []Writer
+
+	for _, site := range s.sites {
+		if site.suppressed == 0 {
+			continue
+		}
+
+		summary := site.summary
+		summary.when = time.Now()
+		summary.fields = Fields{
+			"sampled":    site.summary.msg,
+			"suppressed": site.suppressed,
+		}
+		summary.msg = "Suppressed log messages"
+
+		summaries = append(summaries, summary)
+		outs = append(outs, site.out)
+
+		site.suppressed = 0
+	}
+
+	s.mutex.Unlock()
+
+	for i, summary := range summaries {
+		if err := outs[i].Write(summary); err != nil {
+			reportError(err)
+		}
+	}
+}
+
+// Should the message be output?  Counts the message towards its call site's limit.  If the
+// message is suppressed, a summary is scheduled to be written to out.
+func (s *Sampler) sample(m Message, out Writer) bool {
+	if m.Level() == FatalLevel {
+		return true
+	}
+
+	key := sampleKey{
+		msg:   m.msg,
+		pkg:   m.pkg,
+		file:  m.file,
+		line:  m.line,
+		level: m.Level(),
+	}
+
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sweep(now)
+
+	site, ok := s.sites[key]
+	if !ok {
+		site = &sampleSite{start: now}
+		s.sites[key] = site
+	}
+
+	if now.Sub(site.start) >= s.interval {
+		site.start = now
+		site.count = 0
+	}
+
+	site.count++
+
+	if site.count <= s.first {
+		return true
+	}
+
+	if s.thereafter > 0 && (site.count-s.first)%s.thereafter == 0 {
+		return true
+	}
+
+	site.suppressed++
+	site.out = out
+	site.summary = Message{
+		level: WarnLevel,
+		msg:   m.msg,
+		pkg:   m.pkg,
+		file:  m.file,
+		line:  m.line,
+	}
+
+	s.suppressed++
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.Summarize)
+	}
+
+	return false
+}
+
+// Forgets call sites whose interval has passed and that have no suppressed messages to
+// report, so messages with changing text don't use up memory.  Runs at most once an interval.
+// Must be called with the mutex held.
+func (s *Sampler) sweep(now time.Time) {
+	if now.Sub(s.swept) < s.interval {
+		return
+	}
+
+	for key, site := range s.sites {
+		if site.suppressed == 0 && now.Sub(site.start) >= s.interval {
+			delete(s.sites, key)
+		}
+	}
+
+	s.swept = now
+}
+
+// SampledWriter is an output that samples messages before passing them on to another output.
+// Create one with Sampler.Wrap.
+type SampledWriter struct {
+	sampler *Sampler
+	out     Writer
+}
+
+// Write the message to the wrapped output, unless the sampler suppresses it.
+func (w *SampledWriter) Write(m Message) error {
+	if !w.sampler.sample(m, w.out) {
+		return nil
+	}
+
+	return w.out.Write(m)
+}
+
+// Flush outputs the summaries of any suppressed messages, then flushes the wrapped output, if
+// it buffers messages.
+func (w *SampledWriter) Flush(ctx context.Context) error {
+	w.sampler.Summarize()
+
+	if flusher, ok := w.out.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+
+	return nil
+}
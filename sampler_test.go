@@ -0,0 +1,176 @@
+package kleos_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// A bytes.Buffer that's safe to read while a sampler's timer writes to it.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Lines() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func TestSampler(t *testing.T) {
+	assert := assert.New(t)
+
+	var out syncBuffer
+
+	sampler := kleos.NewSampler(time.Hour, 3, 5)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetSampler(sampler)
+
+	for i := 0; i < 20; i++ {
+		log.Error(errors.New("i/o timeout")).Log("db timeout")
+	}
+
+	// First 3, then the 8th, 13th, and 18th
+	assert.Len(out.Lines(), 6)
+	assert.Equal(uint64(14), sampler.Suppressed())
+
+	sampler.Summarize()
+
+	lines := out.Lines()
+	assert.Len(lines, 7)
+	assert.Contains(lines[6], " WRN Suppressed log messages (kleos/sampler_test.go:")
+	assert.Contains(lines[6], "sampled=\"db timeout\"")
+	assert.Contains(lines[6], "suppressed=14")
+
+	// Nothing more to summarize
+	sampler.Summarize()
+	assert.Len(out.Lines(), 7)
+}
+
+func TestSamplerCallSites(t *testing.T) {
+	assert := assert.New(t)
+
+	var out syncBuffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetSampler(kleos.NewSampler(time.Hour, 1, 0))
+
+	for i := 0; i < 3; i++ {
+		log.Info("first call site")
+		log.Info("second call site")
+		log.Warn().Log("second call site")
+	}
+
+	for i := 0; i < 3; i++ {
+		log.Info("third call site")
+	}
+
+	// Each message, source, and level is sampled separately
+	assert.Len(out.Lines(), 4)
+}
+
+func TestSamplerInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	var out syncBuffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetSampler(kleos.NewSampler(50*time.Millisecond, 2, 0))
+
+	for i := 0; i < 5; i++ {
+		log.Info("noisy")
+	}
+
+	// The summary is output at the end of the interval
+	deadline := time.Now().Add(5 * time.Second)
+	for len(out.Lines()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the summary")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lines := out.Lines()
+	assert.Contains(lines[2], "Suppressed log messages")
+	assert.Contains(lines[2], "suppressed=3")
+
+	// The next interval starts over
+	log.Info("noisy")
+	assert.Len(out.Lines(), 4)
+}
+
+func TestSamplerNoInterval(t *testing.T) {
+	var out syncBuffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetSampler(kleos.NewSampler(0, 1, 0))
+
+	for i := 0; i < 5; i++ {
+		log.Info("noisy")
+	}
+
+	// Uses the default interval, rather than starting a new interval with every message
+	assert.Len(t, out.Lines(), 1)
+}
+
+func TestSamplerFatal(t *testing.T) {
+	var out syncBuffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.SetSampler(kleos.NewSampler(time.Hour, 0, 0))
+
+	log.Info("suppressed")
+	assert.Panics(t, func() { log.Panic("not suppressed") })
+
+	lines := out.Lines()
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "not suppressed")
+}
+
+func TestSampledWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	var sampled, all syncBuffer
+
+	sampler := kleos.NewSampler(time.Hour, 1, 0)
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewMultiWriter().
+		Add(sampler.Wrap(kleos.NewTextOutput(&sampled))).
+		Add(kleos.NewTextOutput(&all)))
+
+	for i := 0; i < 3; i++ {
+		log.Info("noisy")
+	}
+
+	assert.NoError(log.Flush(context.Background()))
+
+	assert.Len(all.Lines(), 3)
+
+	lines := sampled.Lines()
+	if assert.Len(lines, 2) {
+		assert.Contains(lines[1], "suppressed=2")
+	}
+}
@@ -0,0 +1,241 @@
+//go:build go1.21
+
+package kleos
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// SlogHandler is a slog.Handler that logs records through a Kleos logger, so code using the
+// standard library's log/slog package shares the Kleos outputs.
+//
+// Records below slog.LevelInfo are logged as debug messages:  slog.LevelDebug is verbosity 1,
+// and each level below that adds one, so slog.Level(-5) is verbosity 2.  Info, warning, and
+// error records keep their levels.  An attribute named "err" or "error" holding an error is
+// logged as the message's error.
+//
+// Attributes in groups are logged as dotted field names, e.g. "request.id".
+type SlogHandler struct {
+	k      *Kleos
+	fields Fields // attributes added with WithAttrs
+	group  string // prefix for attribute keys, from WithGroup
+}
+
+// NewSlogHandler creates a slog.Handler that logs to the Kleos logger:
+//
+//	slog.SetDefault(slog.New(kleos.NewSlogHandler(kleos.Named("api"))))
+func NewSlogHandler(k *Kleos) *SlogHandler {
+	return &SlogHandler{k: k}
+}
+
+// Enabled reports whether the Kleos logger outputs records at the level.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if level >= slog.LevelInfo {
+		return true
+	}
+
+	// The record's call site isn't known yet, so allow for any verbosity overrides
+	return slogVerbosity(level) <= h.k.maxVerbosity()
+}
+
+// Handle logs the record through the Kleos logger.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	m := newMessage(h.k).Context(ctx)
+
+	m.when = r.Time
+	if m.when.IsZero() {
+		m.when = time.Now()
+	}
+
+	// The source is where slog was called, not where kleos is called from slog
+	if r.PC != 0 {
+		m.pc = []uintptr{r.PC}
+	} else {
+		m.source = false
+	}
+
+	switch {
+	case r.Level < slog.LevelInfo:
+		m.verbosity = slogVerbosity(r.Level)
+	case r.Level < slog.LevelWarn:
+		m.level = InfoLevel
+	case r.Level < slog.LevelError:
+		m.level = WarnLevel
+	default:
+		m.level = ErrorLevel
+	}
+
+	fields := make(Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+
+	r.Attrs(func(attr slog.Attr) bool {
+		if err, ok := attr.Value.Any().(error); ok && h.group == "" && (attr.Key == "err" || attr.Key == "error") {
+			m.error = err
+			return true
+		}
+
+		addAttr(fields, h.group, attr)
+		return true
+	})
+
+	m.With(fields).Log(r.Message)
+
+	return nil
+}
+
+// WithAttrs returns a handler that includes the attributes with every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+
+	for _, attr := range attrs {
+		addAttr(fields, h.group, attr)
+	}
+
+	return &SlogHandler{
+		k:      h.k,
+		fields: fields,
+		group:  h.group,
+	}
+}
+
+// WithGroup returns a handler that adds the group name to the keys of the record's
+// attributes, e.g. "request.id".
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &SlogHandler{
+		k:      h.k,
+		fields: h.fields,
+		group:  h.group + name + ".",
+	}
+}
+
+// Adds the attribute to the fields, with the group as a prefix.  Groups within the attribute
+// are flattened into dotted field names.
+func addAttr(fields Fields, group string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+
+	if attr.Value.Kind() != slog.KindGroup {
+		if attr.Key != "" {
+			fields[group+attr.Key] = attr.Value.Any()
+		}
+		return
+	}
+
+	// Groups without a key are inlined
+	if attr.Key != "" {
+		group += attr.Key + "."
+	}
+
+	for _, child := range attr.Value.Group() {
+		addAttr(fields, group, child)
+	}
+}
+
+// Converts a slog level below slog.LevelInfo to a Kleos verbosity.
+func slogVerbosity(level slog.Level) uint8 {
+	if level >= slog.LevelDebug {
+		return 1
+	}
+
+	verbosity := 1 + int(slog.LevelDebug-level)
+	if verbosity > 255 {
+		return 255
+	}
+
+	return uint8(verbosity)
+}
+
+// SlogOutput is a Writer that passes Kleos log messages to a slog.Handler, e.g. to send Kleos
+// messages to the same place as code using log/slog.
+//
+// Debug messages are logged at slog.LevelDebug minus the verbosity less one, the inverse of
+// SlogHandler.  Fatal messages are logged at slog.LevelError+4.  The error is logged as the
+// "err" attribute.
+type SlogOutput struct {
+	handler slog.Handler
+}
+
+// NewSlogOutput creates a Writer that logs messages to the slog.Handler.
+func NewSlogOutput(handler slog.Handler) *SlogOutput {
+	return &SlogOutput{
+		handler: handler,
+	}
+}
+
+// Write the message to the slog.Handler as a slog.Record.
+func (w *SlogOutput) Write(m Message) error {
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	level := slogLevel(m)
+	if !w.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	var pc uintptr
+	if m.source && m.skip >= 0 && m.skip < len(m.pc) {
+		pc = m.pc[m.skip]
+	}
+
+	r := slog.NewRecord(m.when, level, strings.TrimSpace(m.msg), pc)
+
+	if m.error != nil {
+		r.AddAttrs(slog.Any(JSONError, m.error))
+	}
+
+	fields := sortFields(appendMessageFields(make([]Field, 0, len(m.typed)+8), m.untypedFields(), m.typed))
+	for _, f := range fields {
+		r.AddAttrs(slogAttr(f))
+	}
+
+	return w.handler.Handle(ctx, r)
+}
+
+// Converts a typed field to a slog attribute, without boxing its value.
+func slogAttr(f Field) slog.Attr {
+	switch f.kind {
+	case stringField:
+		return slog.String(f.Key, f.str)
+	case intField, int64Field:
+		return slog.Int64(f.Key, f.num)
+	case float64Field:
+		return slog.Float64(f.Key, f.float())
+	case boolField:
+		return slog.Bool(f.Key, f.num == 1)
+	case durationField:
+		return slog.Duration(f.Key, time.Duration(f.num))
+	case timeField:
+		return slog.Time(f.Key, f.time())
+	}
+
+	return slog.Any(f.Key, f.Value())
+}
+
+// Converts the message's level to a slog level.
+func slogLevel(m Message) slog.Level {
+	switch m.Level() {
+	case DebugLevel:
+		return slog.LevelDebug - slog.Level(m.verbosity) + 1
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	case FatalLevel:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
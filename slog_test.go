@@ -0,0 +1,136 @@
+//go:build go1.21
+
+package kleos_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+
+	logger := slog.New(kleos.NewSlogHandler(k))
+
+	_, _, line := source()
+	logger.Info("Hello World", "user", 5, slog.Group("request", "id", "R1234"))
+
+	output := out.String()
+	assert.Contains(output, " INF Hello World ")
+	assert.Contains(output, "user=5")
+	assert.Contains(output, "request.id=R1234")
+	assert.Contains(output, fmt.Sprintf("(kleos/slog_test.go:%d)", line+1))
+	out.Reset()
+
+	logger.Warn("Running without a replica")
+	assert.Contains(out.String(), " WRN Running without a replica ")
+	out.Reset()
+
+	logger.Error("Unable to connect", "err", errors.New("timeout"))
+	assert.Contains(out.String(), " ERR Unable to connect ")
+	assert.Contains(out.String(), "err=timeout")
+	out.Reset()
+
+	// Info records with an error stay info records
+	logger.Info("Retried", "err", errors.New("timeout"))
+	assert.Contains(out.String(), " INF Retried ")
+	out.Reset()
+}
+
+func TestSlogHandlerVerbosity(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+
+	logger := slog.New(kleos.NewSlogHandler(k))
+
+	logger.Debug("Hello World")
+	assert.Empty(out.String())
+
+	k.SetVerbosity(1)
+	logger.Debug("Hello World")
+	assert.Contains(out.String(), " D01 Hello World ")
+	out.Reset()
+
+	logger.Log(context.Background(), slog.LevelDebug-1, "Hello World")
+	assert.Empty(out.String())
+
+	k.SetVerbosity(2)
+	logger.Log(context.Background(), slog.LevelDebug-1, "Hello World")
+	assert.Contains(out.String(), " D02 Hello World ")
+}
+
+func TestSlogHandlerAttrs(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+
+	logger := slog.New(kleos.NewSlogHandler(k.Named("api"))).
+		With("tenant", "acme").
+		WithGroup("request").
+		With("id", "R1234")
+
+	logger.Info("Hello World", "method", "GET", slog.Group("", "inline", true))
+
+	output := out.String()
+	assert.Contains(output, "logger=api")
+	assert.Contains(output, "tenant=acme")
+	assert.Contains(output, "request.id=R1234")
+	assert.Contains(output, "request.method=GET")
+	assert.Contains(output, "request.inline=true")
+}
+
+func TestSlogOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	handler := slog.NewJSONHandler(&out, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelDebug - 4,
+	})
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewSlogOutput(handler))
+	k.SetVerbosity(2)
+
+	k.V(2).With(kleos.Fields{"user": 5}).Log("Hello World")
+
+	var record map[string]any
+	assert.NoError(json.Unmarshal(out.Bytes(), &record))
+
+	assert.Equal("Hello World", record["msg"])
+	assert.Equal("DEBUG-1", record["level"])
+	assert.Equal(float64(5), record["user"])
+
+	src, _ := record["source"].(map[string]any)
+	assert.Contains(src["file"], "slog_test.go")
+	out.Reset()
+
+	k.Error(errors.New("timeout")).Log("Unable to connect")
+
+	record = nil
+	assert.NoError(json.Unmarshal(out.Bytes(), &record))
+
+	assert.Equal("ERROR", record["level"])
+	assert.Equal("timeout", record["err"])
+}
@@ -3,6 +3,7 @@ package kleos_test
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -142,6 +143,39 @@ func TestLoggerLineNumbers(t *testing.T) {
 	out.Reset()
 }
 
+// Note:  if you change the internals of this test, you may need to update the "base+" values.
+func TestStdLoggerLineNumbers(t *testing.T) {
+	// Set a baseline
+	_, _, base := source()
+
+	var out bytes.Buffer
+
+	k := kleos.New()
+	k.SetOutput(kleos.NewTextOutput(&out))
+
+	std := k.StdLogger(0)
+	std.Printf("Hello %s", "World") // +8
+
+	check(t, out.String(), base+8)
+	assert.Contains(t, out.String(), " INF Hello World ")
+	out.Reset()
+
+	std.Println("Hello World") // +14
+	check(t, out.String(), base+14)
+	out.Reset()
+
+	// Redirect the standard library's logger
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+
+	log.SetFlags(0)
+	log.SetOutput(k.Logger(0))
+	log.Print("Hello World") // +24
+
+	check(t, out.String(), base+24)
+	assert.Contains(t, out.String(), " INF Hello World ")
+}
+
 // Note:  if you change the internals of this test, you may need to update the "base+" values.
 func TestSourceLineNumbers(t *testing.T) {
 	// Set a baseline
@@ -0,0 +1,220 @@
+package kleos
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// StackTracer is implemented by errors that record the call stack where they were created.
+// When logging such an error with stack traces enabled, the error's stack trace is used
+// instead of the stack where the message was logged.
+type StackTracer interface {
+	StackTrace() []uintptr
+}
+
+// Frame is a single function call in a stack trace.
+type Frame struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// The prefix of every function in the kleos package, e.g. "github.com/sbowman/kleos.".
+var kleosPrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+
+	// Everything up to the first dot after the last slash, e.g. not "kleos.init."
+	slash := strings.LastIndex(name, "/") + 1
+	return name[:slash+strings.Index(name[slash:], ".")+1]
+}()
+
+// The most function calls recorded for the source of a log message, including any skipped with
+// Source.
+const maxCallers = 8
+
+// Caches whether a program counter is in the kleos package.  Lock-free, since it's checked
+// for every frame of every call site.
+var kleosCalls sync.Map // uintptr to bool
+
+// SetStackDepth enables stack traces on error messages, recording up to depth function calls.
+// Zero disables stack traces, which is the default.
+func SetStackDepth(depth int) {
+	local.SetStackDepth(depth)
+}
+
+// SetStackDepth enables stack traces on error messages, recording up to depth function calls.
+// Zero disables stack traces, which is the default.
+func (k *Kleos) SetStackDepth(depth int) {
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
+
+	if depth < 0 {
+		depth = 0
+	}
+
+	root.stackDepth = depth
+}
+
+// StackDepth returns the number of function calls recorded in the stack traces of error
+// messages.  Zero if stack traces are disabled.
+func (k *Kleos) StackDepth() int {
+	root := k.base()
+
+	root.RLock()
+	defer root.RUnlock()
+
+	return root.stackDepth
+}
+
+// Stack returns the stack trace of an error message, if stack traces are enabled.
+func (m Message) Stack() []Frame {
+	return m.stack
+}
+
+// Records the stack trace for an error message, if stack traces are enabled.  Uses the
+// error's own stack trace if it has one, otherwise the calls leading to the log message.
+// Must be called from Output.
+func (m Message) captureStack() []Frame {
+	if m.error == nil || m.k == nil {
+		return nil
+	}
+
+	depth := m.k.StackDepth()
+	if depth == 0 {
+		return nil
+	}
+
+	if pc := errorStack(m.error); len(pc) > 0 {
+		return resolveFrames(pc, depth, "")
+	}
+
+	// Start at the function that logged the message, skipping over the kleos functions
+	var start string
+	if m.source && m.skip >= 0 && m.skip < len(m.pc) {
+		start = sourceFrame(m.pc[m.skip]).Function
+	}
+
+	pc := make([]uintptr, depth+32)
+	pc = pc[:runtime.Callers(3, pc)]
+
+	return resolveFrames(pc, depth, start)
+}
+
+// Fills pc with the program counters of the function calls leading to the log message,
+// starting with the first call outside of the kleos package, however deep in kleos the message
+// was logged.  Returns the number of program counters.  Doesn't allocate once the calls have
+// been seen before.
+func callers(pc []uintptr) int {
+	var stack [maxCallers + 8]uintptr
+	n := runtime.Callers(2, stack[:])
+
+	for i := 0; i < n; i++ {
+		if !kleosCall(stack[i]) {
+			return copy(pc, stack[i:n])
+		}
+	}
+
+	return 0
+}
+
+// Is the program counter in a kleos function?  Checks the outermost function, in case a kleos
+// function was inlined into the code logging the message.
+func kleosCall(pc uintptr) bool {
+	if inside, ok := kleosCalls.Load(pc); ok {
+		return inside.(bool)
+	}
+
+	frames := runtime.CallersFrames([]uintptr{pc})
+
+	var frame runtime.Frame
+	for more := true; more; {
+		frame, more = frames.Next()
+	}
+
+	inside := strings.HasPrefix(frame.Function, kleosPrefix)
+	kleosCalls.Store(pc, inside)
+
+	return inside
+}
+
+// Returns the frame of the function that logged the message at the program counter, skipping
+// any kleos functions inlined into it.
+func sourceFrame(pc uintptr) runtime.Frame {
+	frames := runtime.CallersFrames([]uintptr{pc})
+
+	for {
+		frame, more := frames.Next()
+		if !more || !strings.HasPrefix(frame.Function, kleosPrefix) {
+			return frame
+		}
+	}
+}
+
+// Returns the stack trace of the innermost error that has one.
+func errorStack(err error) []uintptr {
+	var pc []uintptr
+
+	for err != nil {
+		var tracer StackTracer
+		if !errors.As(err, &tracer) {
+			break
+		}
+
+		pc = tracer.StackTrace()
+		err = errors.Unwrap(tracer.(error))
+	}
+
+	return pc
+}
+
+// Converts up to depth program counters into frames.  If start is set, frames before the
+// first call to the start function are skipped.  Otherwise calls inside the kleos package are
+// skipped.
+func resolveFrames(pc []uintptr, depth int, start string) []Frame {
+	var stack []Frame
+
+	frames := runtime.CallersFrames(pc)
+	for len(stack) < depth {
+		frame, more := frames.Next()
+
+		if len(stack) == 0 {
+			if start != "" && frame.Function != start {
+				if !more {
+					break
+				}
+				continue
+			}
+
+			if start == "" && strings.HasPrefix(frame.Function, kleosPrefix) {
+				if !more {
+					break
+				}
+				continue
+			}
+		}
+
+		if frame.Function != "" {
+			stack = append(stack, Frame{
+				Func: frame.Function,
+				File: frame.File,
+				Line: frame.Line,
+			})
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	// Couldn't find the function that logged the message, so start outside of kleos
+	if len(stack) == 0 && start != "" {
+		return resolveFrames(pc, depth, "")
+	}
+
+	return stack
+}
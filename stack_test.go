@@ -0,0 +1,112 @@
+package kleos_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// An error that records where it was created.
+type tracedError struct {
+	msg string
+	pc  []uintptr
+}
+
+func newTracedError(msg string) error {
+	pc := make([]uintptr, 10)
+	pc = pc[:runtime.Callers(2, pc)]
+
+	return &tracedError{msg: msg, pc: pc}
+}
+
+func (e *tracedError) Error() string {
+	return e.msg
+}
+
+func (e *tracedError) StackTrace() []uintptr {
+	return e.pc
+}
+
+func failingQuery() error {
+	return newTracedError("connection reset")
+}
+
+func logFailure(log *kleos.Kleos, err error) {
+	log.Error(err).Log("Unable to save")
+}
+
+func TestStackTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+
+	// Disabled by default
+	logFailure(log, errors.New("yikes"))
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+	out.Reset()
+
+	log.SetStackDepth(2)
+	logFailure(log, errors.New("yikes"))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if assert.Len(lines, 5) {
+		assert.Contains(lines[0], " ERR Unable to save ")
+		assert.Equal("\tgithub.com/sbowman/kleos_test.logFailure", lines[1])
+		assert.True(strings.HasPrefix(lines[2], "\t\t"))
+		assert.Contains(lines[2], "stack_test.go:")
+		assert.Equal("\tgithub.com/sbowman/kleos_test.TestStackTrace", lines[3])
+	}
+	out.Reset()
+
+	// Only error messages get a stack trace
+	log.Log("Saved")
+	assert.Equal(1, strings.Count(out.String(), "\n"))
+}
+
+func TestStackTraceGlobal(t *testing.T) {
+	var out bytes.Buffer
+
+	kleos.SetOutput(kleos.NewTextOutput(&out))
+	kleos.SetStackDepth(1)
+	defer kleos.SetStackDepth(0)
+
+	kleos.Error(errors.New("yikes")).Log("Unable to save")
+
+	assert.Contains(t, out.String(), "\n\tgithub.com/sbowman/kleos_test.TestStackTraceGlobal\n")
+}
+
+func TestStackTraceJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewJSONOutput(&out))
+	log.SetStackDepth(3)
+
+	// Uses the stack trace from the error, even when wrapped
+	err := fmt.Errorf("saving invoice: %w", failingQuery())
+	logFailure(log, err)
+
+	var doc struct {
+		Stack []kleos.Frame `json:"stack"`
+	}
+	assert.NoError(json.Unmarshal(out.Bytes(), &doc))
+
+	if assert.Len(doc.Stack, 3) {
+		assert.Equal("github.com/sbowman/kleos_test.failingQuery", doc.Stack[0].Func)
+		assert.Contains(doc.Stack[0].File, "stack_test.go")
+		assert.NotZero(doc.Stack[0].Line)
+		assert.Equal("github.com/sbowman/kleos_test.TestStackTraceJSON", doc.Stack[1].Func)
+	}
+}
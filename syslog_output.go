@@ -0,0 +1,399 @@
+package kleos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Facility is the syslog facility, indicating the type of program logging the message.
+type Facility uint8
+
+// Syslog facilities, as defined by RFC 5424.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+)
+
+// Local use syslog facilities, as defined by RFC 5424.
+const (
+	FacilityLocal0 Facility = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// SyslogFormat is the format of the syslog messages.
+type SyslogFormat uint8
+
+const (
+	// RFC5424 is the modern syslog format, with structured data.
+	RFC5424 SyslogFormat = iota
+
+	// RFC3164 is the older BSD syslog format.  Fields are added to the end of the message.
+	RFC3164
+)
+
+// DefaultSDID is the default ID of the structured data element holding the fields.  32473 is
+// the private enterprise number reserved for documentation; use your own if you have one.
+const DefaultSDID = "fields@32473"
+
+// Where the syslog daemon typically listens on the local machine.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// ErrNoSyslog returned when no local syslog daemon could be found.
+var ErrNoSyslog = errors.New("unable to connect to the local syslog daemon")
+
+// SyslogOutput is a Writer that sends log messages to a syslog daemon, such as rsyslog, over a
+// Unix datagram socket, UDP, or TCP.  Messages are formatted per RFC 5424 by default, with the
+// fields, source, and error in a structured data element; see SDID.  Set Format to RFC3164 for
+// older daemons.
+//
+// Messages sent over TCP use octet-counting framing, as described by RFC 6587.
+//
+// Kleos levels are mapped to syslog severities:  debug messages are "debug", info messages
+// are "informational", warnings are "warning", errors are "error", and fatal messages are
+// "critical".
+//
+// Configure the SyslogOutput before writing to it.
+type SyslogOutput struct {
+	sync.Mutex
+
+	Facility Facility     // the syslog facility; defaults to FacilityUser
+	Format   SyslogFormat // the message format; defaults to RFC5424
+	Hostname string       // the HOSTNAME field; defaults to the system's host name
+	AppName  string       // the APP-NAME field, or the tag in RFC 3164
+	SDID     string       // the ID of the structured data element with the fields
+
+	network string
+	addr    string
+	pid     int
+	conn    net.Conn
+}
+
+// DialSyslog connects to the syslog daemon.  The network may be "unixgram", "udp", or "tcp";
+// if network and addr are empty, connects to the local syslog daemon's Unix socket, e.g.
+// /dev/log.  The app name defaults to the name of the program.
+func DialSyslog(network, addr, app string) (*SyslogOutput, error) {
+	host, _ := os.Hostname()
+
+	if app == "" {
+		app = filepath.Base(os.Args[0])
+	}
+
+	w := &SyslogOutput{
+		Facility: FacilityUser,
+		Hostname: host,
+		AppName:  app,
+		SDID:     DefaultSDID,
+		network:  network,
+		addr:     addr,
+		pid:      os.Getpid(),
+	}
+
+	if err := w.dial(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Close the connection to the syslog daemon.
+func (w *SyslogOutput) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
+
+// Write the message to the syslog daemon.  If the connection was lost, reconnects and tries
+// once more.
+func (w *SyslogOutput) Write(m Message) error {
+	var msg []byte
+	if w.Format == RFC3164 {
+		msg = w.formatRFC3164(m)
+	} else {
+		msg = w.formatRFC5424(m)
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return nil
+		}
+
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.dial(); err != nil {
+		return err
+	}
+
+	return w.send(msg)
+}
+
+// Connects to the syslog daemon.  Must be called with the mutex held, or before the output is
+// shared.
+func (w *SyslogOutput) dial() error {
+	if w.network != "" || w.addr != "" {
+		conn, err := net.Dial(w.network, w.addr)
+		if err != nil {
+			return err
+		}
+
+		w.conn = conn
+		return nil
+	}
+
+	for _, path := range syslogSockets {
+		conn, err := net.Dial("unixgram", path)
+		if err == nil {
+			w.conn = conn
+			w.network = "unixgram"
+			w.addr = path
+			return nil
+		}
+	}
+
+	return ErrNoSyslog
+}
+
+// Sends the message, framed for TCP if necessary.  Must be called with the mutex held.
+func (w *SyslogOutput) send(msg []byte) error {
+	if strings.HasPrefix(w.network, "tcp") {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// Returns the syslog priority of the message:  the facility and severity combined.
+func (w *SyslogOutput) priority(m Message) int {
+	return int(w.Facility)*8 + syslogSeverity(m.Level())
+}
+
+// Formats the message per RFC 5424, e.g.
+// `<14>1 2006-01-02T15:04:05.000000Z host app 123 - [fields@32473 id="5"] message`.
+func (w *SyslogOutput) formatRFC5424(m Message) []byte {
+	var b bytes.Buffer
+
+	_, _ = fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		w.priority(m),
+		m.when.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(w.Hostname, 255),
+		syslogHeader(w.AppName, 48),
+		w.pid)
+
+	params := w.params(m)
+	if len(params) == 0 {
+		b.WriteString("-")
+	} else {
+		sdid := w.SDID
+		if sdid == "" {
+			sdid = DefaultSDID
+		}
+
+		b.WriteString("[")
+		b.WriteString(syslogName(sdid))
+
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			b.WriteString(" ")
+			b.WriteString(syslogName(k))
+			b.WriteString(`="`)
+			b.WriteString(syslogParamValue(params[k]))
+			b.WriteString(`"`)
+		}
+
+		b.WriteString("]")
+	}
+
+	if msg := strings.TrimSpace(m.msg); msg != "" {
+		b.WriteString(" ")
+		b.WriteString(msg)
+	}
+
+	return b.Bytes()
+}
+
+// Formats the message per RFC 3164, e.g. `<14>Jan  2 15:04:05 host app[123]: message id=5`.
+func (w *SyslogOutput) formatRFC3164(m Message) []byte {
+	var b bytes.Buffer
+
+	_, _ = fmt.Fprintf(&b, "<%d>%s %s %s[%d]: %s",
+		w.priority(m),
+		m.when.Local().Format(time.Stamp),
+		syslogHeader(w.Hostname, 255),
+		syslogHeader(w.AppName, 32),
+		w.pid,
+		strings.TrimSpace(m.msg))
+
+	params := w.params(m)
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		b.WriteString(" ")
+		b.WriteString(k)
+		b.WriteString("=")
+
+		value := params[k]
+		if strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+
+	return bytes.ReplaceAll(b.Bytes(), []byte("\n"), []byte(" "))
+}
+
+// Collects the fields, source, verbosity, and error of the message as unquoted strings.
+func (w *SyslogOutput) params(m Message) map[string]string {
+	fields := m.untypedFields()
+	params := make(map[string]string, len(fields)+len(m.typed)+5)
+
+	for k, v := range fields {
+		if value := encodePlain(v); value != "" {
+			params[k] = value
+		}
+	}
+
+	// Typed fields take precedence, and aren't boxed
+	for _, f := range m.typed {
+		if value := encodePlainField(f); value != "" {
+			params[f.Key] = value
+		} else {
+			delete(params, f.Key)
+		}
+	}
+
+	if m.verbosity > 0 {
+		params[JSONVerbosity] = strconv.Itoa(int(m.verbosity))
+	}
+
+	if m.file != "" {
+		params[JSONPkg] = m.pkg
+		params[JSONSrc] = m.file
+		params[JSONLine] = strconv.Itoa(m.line)
+	}
+
+	if m.error != nil {
+		params[JSONError] = m.error.Error()
+	}
+
+	return params
+}
+
+// Converts a Kleos level to a syslog severity.
+func syslogSeverity(level Level) int {
+	switch level {
+	case DebugLevel:
+		return 7
+	case WarnLevel:
+		return 4
+	case ErrorLevel:
+		return 3
+	case FatalLevel:
+		return 2
+	default:
+		return 6
+	}
+}
+
+// Cleans up a header field, such as the hostname, which may only contain printable ASCII
+// characters other than spaces.  Empty fields are replaced with "-".
+func syslogHeader(value string, max int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+
+	if value == "" {
+		return "-"
+	}
+
+	if len(value) > max {
+		value = value[:max]
+	}
+
+	return value
+}
+
+// Cleans up a structured data ID or parameter name, which may only contain printable ASCII
+// characters other than spaces, `=`, `]`, and `"`, and may be no longer than 32 characters.
+func syslogName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if name == "" {
+		return "_"
+	}
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	return name
+}
+
+// Escapes a structured data parameter value:  `"`, `\`, and `]` are escaped with a backslash.
+func syslogParamValue(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '"', '\\', ']':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package kleos_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// Listens for syslog datagrams, returning a channel of the messages received.
+func listenSyslogPacket(t *testing.T, network, addr string) (string, <-chan string) {
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	msgs := make(chan string, 10)
+
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+
+	return conn.LocalAddr().String(), msgs
+}
+
+// Listens for syslog messages over TCP, using octet-counted framing.
+func listenSyslogTCP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	msgs := make(chan string, 10)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			prefix, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+
+			n, err := strconv.Atoi(prefix[:len(prefix)-1])
+			if err != nil {
+				msgs <- "bad frame: " + prefix
+				return
+			}
+
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			msgs <- string(msg)
+		}
+	}()
+
+	return listener.Addr().String(), msgs
+}
+
+// Waits for the next syslog message.
+func nextSyslog(t *testing.T, msgs <-chan string) string {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a syslog message")
+		return ""
+	}
+}
+
+func newSyslogLogger(t *testing.T, network, addr string) (*kleos.Kleos, *kleos.SyslogOutput) {
+	out, err := kleos.DialSyslog(network, addr, "test-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = out.Close() })
+
+	out.Hostname = "test-host"
+
+	log := kleos.New()
+	log.SetOutput(out)
+
+	return log, out
+}
+
+func TestSyslogRFC5424(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, msgs := listenSyslogPacket(t, "udp", "127.0.0.1:0")
+	log, _ := newSyslogLogger(t, "udp", addr)
+
+	log.With(kleos.Fields{"user": "jdoe", "note": `say "hi" [now]`}).
+		Error(errors.New("boom")).
+		Log("Request failed")
+
+	pid := strconv.Itoa(os.Getpid())
+	re := regexp.MustCompile(`^<11>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z test-host test-app ` + pid + ` - ` +
+		`\[fields@32473 err="boom" line="\d+" note="say \\"hi\\" \[now\\]" pkg="kleos" src="syslog_output_test.go" user="jdoe"\] Request failed$`)
+
+	assert.Regexp(re, nextSyslog(t, msgs))
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, msgs := listenSyslogPacket(t, "udp", "127.0.0.1:0")
+	log, out := newSyslogLogger(t, "udp", addr)
+	out.Facility = kleos.FacilityLocal0
+
+	log.SetVerbosity(2)
+
+	log.V(2).Log("debug")
+	assert.Regexp(`^<135>1 .* \[fields@32473 .*v="2"\] debug$`, nextSyslog(t, msgs))
+
+	log.Info("info")
+	assert.Regexp(`^<134>1 `, nextSyslog(t, msgs))
+
+	log.Warn().Log("warn")
+	assert.Regexp(`^<132>1 `, nextSyslog(t, msgs))
+
+	log.Error(errors.New("oops")).Log("error")
+	assert.Regexp(`^<131>1 `, nextSyslog(t, msgs))
+}
+
+func TestSyslogNoStructuredData(t *testing.T) {
+	addr, msgs := listenSyslogPacket(t, "udp", "127.0.0.1:0")
+	log, _ := newSyslogLogger(t, "udp", addr)
+	log.EnableSource(false)
+
+	log.Log("plain")
+
+	assert.Regexp(t, `^<14>1 \S+ test-host test-app \d+ - - plain$`, nextSyslog(t, msgs))
+}
+
+func TestSyslogRFC3164(t *testing.T) {
+	addr, msgs := listenSyslogPacket(t, "udp", "127.0.0.1:0")
+	log, out := newSyslogLogger(t, "udp", addr)
+	out.Format = kleos.RFC3164
+
+	log.With(kleos.Fields{"user": "jdoe", "note": "two words"}).Log("Signed in")
+
+	pid := strconv.Itoa(os.Getpid())
+	assert.Regexp(t, `^<14>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} test-host test-app\[`+pid+`\]: `+
+		`Signed in line=\d+ note="two words" pkg=kleos src=syslog_output_test.go user=jdoe$`, nextSyslog(t, msgs))
+}
+
+func TestSyslogTCP(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, msgs := listenSyslogTCP(t)
+	log, _ := newSyslogLogger(t, "tcp", addr)
+
+	for i := 0; i < 3; i++ {
+		log.Log(fmt.Sprintf("message %d", i))
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Regexp(fmt.Sprintf(`^<14>1 .* message %d$`, i), nextSyslog(t, msgs))
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	_, msgs := listenSyslogPacket(t, "unixgram", path)
+	log, _ := newSyslogLogger(t, "unixgram", path)
+
+	log.Log("local")
+
+	assert.Regexp(t, `^<14>1 .* local$`, nextSyslog(t, msgs))
+}
@@ -13,7 +13,7 @@ func main() {
 	}
 	defer writer.Close()
 
-	elk := kleos.NewJSONOutput("testing", writer)
+	elk := kleos.NewJSONOutput(writer)
 	elk.Timestamp = "@timestamp"
 	kleos.SetOutput(elk)
 
@@ -21,16 +21,16 @@ func main() {
 	// kleos.SetOutput(tw)
 
 	kleos.WithFields(kleos.Fields{
-		"name": "James T. Kirk",
-		"rank": "Captain",
+		"name":       "James T. Kirk",
+		"rank":       "Captain",
 		"assignment": "U.S.S. Enterprise",
-		"mission": 5,
+		"mission":    5,
 	}).Info("Recording new mission")
 
 	kleos.WithFields(kleos.Fields{
-		"name": "Spock",
-		"rank": "Commander",
+		"name":       "Spock",
+		"rank":       "Commander",
 		"assignment": "U.S.S. Enterprise",
-		"mission": 5,
+		"mission":    5,
 	}).Info("Added science officer")
 }
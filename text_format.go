@@ -0,0 +1,364 @@
+package kleos
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TruncatedMarker is appended to values cut short by TextFormat.MaxLength.
+const TruncatedMarker = "…"
+
+// NestedFormat is how the text outputs render maps, slices, and structs.
+type NestedFormat uint8
+
+const (
+	// NestedJSON renders nested values as compact JSON, e.g. `user="{\"id\":5}"`.
+	NestedJSON NestedFormat = iota
+
+	// NestedFlatten renders each value in a nested value as its own field, with dotted keys,
+	// e.g. `user.id=5`.  Slice elements are numbered, e.g. `tags.0=admin`.
+	NestedFlatten
+)
+
+// BytesFormat is how the text outputs render byte slices.
+type BytesFormat uint8
+
+const (
+	// BytesHex renders byte slices in hexadecimal, e.g. `0aff`.
+	BytesHex BytesFormat = iota
+
+	// BytesBase64 renders byte slices in standard base64, e.g. `Cv8=`.
+	BytesBase64
+)
+
+// TextFormat configures how the TextOutput and ColorOutput render field values.  The zero
+// value renders nested values as JSON and byte slices in hex, without truncating anything.
+//
+// Values are rendered as the first that applies:  numbers, booleans, strings, durations, times,
+// and UUIDs as you'd expect; errors by their message; fmt.Stringer, encoding.TextMarshaler,
+// and json.Marshaler by their text; pointers by the value they point to; and maps, slices,
+// and structs according to Nested.
+type TextFormat struct {
+	Nested    NestedFormat // how to render maps, slices, and structs
+	Bytes     BytesFormat  // how to render byte slices
+	MaxLength int          // truncate longer values to this many characters; zero for no limit
+}
+
+// Encodes a field value, logfmt style.  Errors are always quoted.
+func (tf TextFormat) encode(value interface{}) string {
+	if err, ok := value.(error); ok && !nilPointer(err) {
+		return quoteString(tf.truncate(err.Error()))
+	}
+
+	return encodeString(tf.truncate(tf.plain(value)))
+}
+
+// Renders a field value as plain text, without quotes.  Blank UUIDs and zero times are empty.
+func (tf TextFormat) plain(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return v
+	case int:
+		return strconv.FormatInt(int64(v), 10)
+	case int8:
+		return strconv.FormatInt(int64(v), 10)
+	case int16:
+		return strconv.FormatInt(int64(v), 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case uintptr:
+		return strconv.FormatUint(uint64(v), 10)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', 5, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 5, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(RFC3339Ms)
+	case uuid.UUID:
+		if BlankUUID(v) {
+			return ""
+		}
+		return v.String()
+	case []byte:
+		if tf.Bytes == BytesBase64 {
+			return base64.StdEncoding.EncodeToString(v)
+		}
+		return hex.EncodeToString(v)
+	}
+
+	if nilPointer(value) {
+		return "<nil>"
+	}
+
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return string(text)
+		}
+	case json.Marshaler:
+		return compactJSON(value)
+	}
+
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return tf.plain(rv.Elem().Interface())
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return compactJSON(value)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// Encodes a typed field's value, the same as encode would encode its value, but without
+// boxing it.
+func (tf TextFormat) encodeField(f Field) string {
+	switch f.kind {
+	case stringField:
+		return encodeString(tf.truncate(f.str))
+	case objectField, errorField:
+		return tf.encode(f.value)
+	}
+
+	return tf.plainField(f)
+}
+
+// Renders a typed field's value as plain text, the same as plain would render its value, but
+// without boxing it.
+func (tf TextFormat) plainField(f Field) string {
+	switch f.kind {
+	case stringField:
+		return f.str
+	case intField, int64Field:
+		return strconv.FormatInt(f.num, 10)
+	case float64Field:
+		return strconv.FormatFloat(f.float(), 'f', 5, 64)
+	case boolField:
+		return strconv.FormatBool(f.num == 1)
+	case durationField:
+		return time.Duration(f.num).String()
+	case timeField:
+		if t := f.time(); !t.IsZero() {
+			return t.Format(RFC3339Ms)
+		}
+		return ""
+	case uuidField:
+		if id := f.uuid(); !BlankUUID(id) {
+			return id.String()
+		}
+		return ""
+	}
+
+	return tf.plain(f.value)
+}
+
+// Cuts the value short at MaxLength characters, marking it with TruncatedMarker.
+func (tf TextFormat) truncate(s string) string {
+	if tf.MaxLength <= 0 || len(s) <= tf.MaxLength {
+		return s
+	}
+
+	count := 0
+	for i := range s {
+		if count == tf.MaxLength {
+			return s[:i] + TruncatedMarker
+		}
+		count++
+	}
+
+	return s
+}
+
+// A field encoded for the text outputs.
+type textField struct {
+	key   string
+	value string
+}
+
+// Encodes the message's fields for the text outputs:  the typed fields in the order they were
+// added, followed by the rest of the fields in alphabetical order.  Fields with empty values
+// are skipped.
+func (tf TextFormat) fields(m Message) []textField {
+	typed := uniqueFields(m.typed)
+	fields := m.untypedFields()
+
+	if len(typed) == 0 && len(fields) == 0 {
+		return nil
+	}
+
+	encoded := make([]textField, 0, len(typed)+len(fields))
+
+	for _, f := range typed {
+		if f.kind == objectField {
+			encoded = tf.appendField(encoded, f.Key, f.value)
+			continue
+		}
+
+		if v := tf.encodeField(f); v != "" {
+			encoded = append(encoded, textField{sanitizeKey(f.Key), v})
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for field := range fields {
+		if _, ok := findField(typed, field); !ok {
+			keys = append(keys, field)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		encoded = tf.appendField(encoded, k, fields[k])
+	}
+
+	return encoded
+}
+
+// Appends the encoded field, or its flattened fields if it's a nested value and the format
+// flattens them.
+func (tf TextFormat) appendField(encoded []textField, key string, value interface{}) []textField {
+	if tf.Nested == NestedFlatten && nested(value) {
+		if generic, ok := decodeJSON(value); ok {
+			return tf.flatten(encoded, key, generic)
+		}
+	}
+
+	if v := tf.encode(value); v != "" {
+		encoded = append(encoded, textField{sanitizeKey(key), v})
+	}
+
+	return encoded
+}
+
+// Appends the fields of a nested value decoded from JSON, with dotted keys.
+func (tf TextFormat) flatten(encoded []textField, key string, value interface{}) []textField {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return append(encoded, textField{sanitizeKey(key), "{}"})
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			encoded = tf.flatten(encoded, key+"."+k, v[k])
+		}
+
+		return encoded
+	case []interface{}:
+		if len(v) == 0 {
+			return append(encoded, textField{sanitizeKey(key), "[]"})
+		}
+
+		for i, elem := range v {
+			encoded = tf.flatten(encoded, key+"."+strconv.Itoa(i), elem)
+		}
+
+		return encoded
+	case nil:
+		return append(encoded, textField{sanitizeKey(key), "null"})
+	case json.Number:
+		return append(encoded, textField{sanitizeKey(key), string(v)})
+	}
+
+	if s := tf.encode(value); s != "" {
+		encoded = append(encoded, textField{sanitizeKey(key), s})
+	}
+
+	return encoded
+}
+
+// Is the value a map, slice, array, or struct, or a pointer to one, that doesn't render
+// itself as text?
+func nested(value interface{}) bool {
+	switch value.(type) {
+	case nil, []byte, time.Time, uuid.UUID, error, fmt.Stringer, encoding.TextMarshaler, json.Marshaler:
+		return false
+	}
+
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return !rv.IsNil() && nested(rv.Elem().Interface())
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+
+	return false
+}
+
+// Marshals the value to compact JSON, without escaping HTML characters.  Falls back on Go's
+// formatting if the value can't be marshaled.
+func compactJSON(value interface{}) string {
+	var b bytes.Buffer
+
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Converts the value to its generic JSON form, so struct tags and json.Marshalers are
+// honored when flattening it.
+func decodeJSON(value interface{}) (interface{}, bool) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, false
+	}
+
+	return generic, true
+}
@@ -3,7 +3,6 @@ package kleos
 import (
 	"fmt"
 	"io"
-	"sort"
 	"strings"
 	"sync"
 )
@@ -11,6 +10,7 @@ import (
 // TextOutput is meant to output to stdout or stderr in black and white.
 type TextOutput struct {
 	sync.Mutex
+	TextFormat
 	out io.Writer
 }
 
@@ -28,16 +28,21 @@ func (w *TextOutput) Write(m Message) error {
 
 	_, _ = fmt.Fprint(w.out, m.when.UTC().Format(PaddedRFC3339Ms))
 
-	if m.verbosity > 0 {
+	switch m.Level() {
+	case DebugLevel:
 		_, _ = fmt.Fprintf(w.out, " D%02d", m.verbosity)
-	} else if m.error == nil {
-		_, _ = fmt.Fprint(w.out, " INF")
-	} else {
+	case WarnLevel:
+		_, _ = fmt.Fprint(w.out, " WRN")
+	case ErrorLevel:
 		_, _ = fmt.Fprint(w.out, " ERR")
+	case FatalLevel:
+		_, _ = fmt.Fprint(w.out, " FTL")
+	default:
+		_, _ = fmt.Fprint(w.out, " INF")
 	}
 
 	// Write out the human-readable message
-	msg := strings.TrimSpace(m.msg)
+	msg := sanitizeText(strings.TrimSpace(m.msg))
 	if msg != "" {
 		_, _ = fmt.Fprint(w.out, " ")
 		_, _ = fmt.Fprint(w.out, msg)
@@ -50,37 +55,22 @@ func (w *TextOutput) Write(m Message) error {
 
 	if m.error != nil {
 		_, _ = fmt.Fprint(w.out, ", err=")
-		_, _ = fmt.Fprint(w.out, encode(m.error.Error()))
+		_, _ = fmt.Fprint(w.out, w.encode(m.error.Error()))
 	}
 
-	if m.fields == nil {
-		m.fields = make(Fields)
+	for _, field := range w.fields(m) {
+		_, _ = fmt.Fprint(w.out, ", ")
+		_, _ = fmt.Fprint(w.out, field.key)
+		_, _ = fmt.Fprint(w.out, "=")
+		_, _ = fmt.Fprint(w.out, field.value)
 	}
 
-	// Applies any registered context variables to the fields
-	contexts.Run(m.ctx, m.fields)
-
-	if len(m.fields) > 0 {
-		// Write the fields in alphabetical order
-		var fields []string
-		for field := range m.fields {
-			fields = append(fields, field)
-		}
-		sort.Strings(fields)
-
-		for _, k := range fields {
-			v := encode(m.fields[k])
+	_, _ = fmt.Fprintln(w.out)
 
-			if v != "" {
-				_, _ = fmt.Fprint(w.out, ", ")
-				_, _ = fmt.Fprint(w.out, k)
-				_, _ = fmt.Fprint(w.out, "=")
-				_, _ = fmt.Fprint(w.out, v)
-			}
-		}
+	// Stack traces are indented beneath the message
+	for _, frame := range m.stack {
+		_, _ = fmt.Fprintf(w.out, "\t%s\n\t\t%s:%d\n", frame.Func, frame.File, frame.Line)
 	}
 
-	_, _ = fmt.Fprintln(w.out)
-
 	return nil
 }
@@ -0,0 +1,288 @@
+package kleos_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sbowman/kleos"
+	"github.com/stretchr/testify/assert"
+)
+
+// Logs a message with a single field to text output, returning the line.
+func logText(msg, key, value string) string {
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.EnableSource(false)
+
+	log.Add(kleos.String(key, value)).Log(msg)
+
+	return out.String()
+}
+
+func TestTextEncoding(t *testing.T) {
+	tests := []struct {
+		comment string
+		value   string
+		want    string
+	}{
+		{"plain", "bob", "bob"},
+		{"spaces", "NBC Sports", `"NBC Sports"`},
+		{"equals", "a=b", `"a=b"`},
+		{"quotes", `say "hi"`, `"say \"hi\""`},
+		{"backslash", `C:\Temp`, `C:\Temp`},
+		{"quoted backslash", `C:\Program Files`, `"C:\\Program Files"`},
+		{"newline", "one\ntwo", `"one\ntwo"`},
+		{"carriage return", "one\rtwo", `"one\rtwo"`},
+		{"tab", "one\ttwo", `"one\ttwo"`},
+		{"ansi", "\x1b[31mred\x1b[0m", `"\u001b[31mred\u001b[0m"`},
+		{"unicode", "café", "café"},
+		{"line separator", "one\u2028two", `"one\u2028two"`},
+		{"invalid utf-8", "bad\xffbyte", `"bad\ufffdbyte"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			line := logText("", "key", test.value)
+			assert.True(t, strings.HasSuffix(line, " INF, key="+test.want+"\n"), line)
+		})
+	}
+}
+
+func TestTextSanitizing(t *testing.T) {
+	assert := assert.New(t)
+
+	// Forging a second log line
+	line := logText("Signed in\n2024-03-09T17:04:05.000Z INF Granted admin", "user", "bob")
+	assert.Equal(1, strings.Count(line, "\n"))
+	assert.Contains(line, ` INF Signed in\n2024-03-09T17:04:05.000Z INF Granted admin, user=bob`)
+
+	line = logText("\x1b[2JCleared", "user", "bob")
+	assert.Contains(line, ` INF \u001b[2JCleared, user=bob`)
+
+	line = logText("Hello", "bad key=\"x\"\n", "bob")
+	assert.Contains(line, " INF Hello, bad_key__x__=bob\n")
+
+	// Backslashes are escaped, so a literal "\n" isn't mistaken for a newline
+	line = logText(`Saved C:\new`, "user", "bob")
+	assert.Contains(line, ` INF Saved C:\\new, user=bob`)
+
+	// Forging fields or a source
+	line = logText("Signed in, admin=true", "user", "bob")
+	assert.Contains(line, ` INF Signed in\, admin=true, user=bob`)
+
+	line = logText("Signed in (auth/admin.go:1)", "user", "bob")
+	assert.Contains(line, ` INF Signed in \(auth/admin.go:1), user=bob`)
+
+	// Only where they could be mistaken for fields or a source
+	line = logText("Hello, World (again)", "user", "bob")
+	assert.Contains(line, ` INF Hello, World (again), user=bob`)
+}
+
+func TestCleanup(t *testing.T) {
+	assert.Equal(t, "onetwothree", kleos.Cleanup("one\ntwo\r\nthree"))
+}
+
+// Checks that the text output is a single line with a single field, and returns the field's
+// key and decoded value.
+func parseTextField(t *testing.T, line string) (string, string) {
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected a single line: %q", line)
+	}
+
+	for _, r := range strings.TrimSuffix(line, "\n") {
+		if r != ' ' && (r == utf8.RuneError || !unicode.IsPrint(r)) {
+			t.Fatalf("unprintable character %U: %q", r, line)
+		}
+	}
+
+	_, field, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " INF, ")
+	if !ok {
+		t.Fatalf("missing field: %q", line)
+	}
+
+	key, value, ok := strings.Cut(field, "=")
+	if !ok || key == "" || strings.ContainsAny(key, " \"") {
+		t.Fatalf("invalid key: %q", line)
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			t.Fatalf("invalid quoted value %s: %q", err, line)
+		}
+
+		return key, unquoted
+	}
+
+	if strings.ContainsAny(value, " =\"") {
+		t.Fatalf("unquoted value needs quoting: %q", line)
+	}
+
+	return key, value
+}
+
+func FuzzTextValue(f *testing.F) {
+	for _, seed := range []string{"bob", "NBC Sports", "a=b", `"`, "\n", "\x1b[31m", "\xff", "\u2028", `\"`, "\U000e0001"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		line := logText("", "key", value)
+
+		// Empty values are left out
+		if value == "" {
+			return
+		}
+
+		key, decoded := parseTextField(t, line)
+		assert.Equal(t, "key", key)
+
+		// Invalid bytes are replaced
+		assert.Equal(t, string([]rune(value)), decoded)
+	})
+}
+
+func FuzzTextMessage(f *testing.F) {
+	for _, seed := range []string{"Hello World", "one\ntwo", "\r\n", "\x1b[2J", "\xff\xfe", "a\u0085b", `C:\new`, "a, b=c", "a (b/c.go:1)"} {
+		f.Add(seed, "key")
+	}
+
+	f.Fuzz(func(t *testing.T, msg, key string) {
+		line := logText(msg, key, "value")
+
+		if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+			t.Fatalf("expected a single line: %q", line)
+		}
+
+		for _, r := range strings.TrimSuffix(line, "\n") {
+			if r != ' ' && (r == utf8.RuneError || !unicode.IsPrint(r)) {
+				t.Fatalf("unprintable character %U: %q", r, line)
+			}
+		}
+
+		// The key can't break out of the field
+		if !strings.HasSuffix(line, "=value\n") {
+			t.Fatalf("missing field: %q", line)
+		}
+
+		// The message can't pass for fields, and its escaping can be reversed
+		m, err := kleos.ParseMessage([]byte(logText(msg, "key", "value")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, string([]rune(strings.TrimSpace(msg))), m.Text())
+		assert.Equal(t, kleos.Fields{"key": "value"}, m.Fields())
+	})
+}
+
+type textUser struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+type textLevel int
+
+func (l textLevel) MarshalText() ([]byte, error) {
+	return []byte("level-" + strconv.Itoa(int(l))), nil
+}
+
+type textPoint struct {
+	X, Y int
+}
+
+func (p textPoint) MarshalJSON() ([]byte, error) {
+	return []byte(`[` + strconv.Itoa(p.X) + `,` + strconv.Itoa(p.Y) + `]`), nil
+}
+
+// Logs a message with a single field to text output with the given format, returning the
+// fields.
+func logTextFormat(format kleos.TextFormat, key string, value interface{}) string {
+	var out bytes.Buffer
+
+	output := kleos.NewTextOutput(&out)
+	output.TextFormat = format
+
+	log := kleos.New()
+	log.SetOutput(output)
+	log.EnableSource(false)
+
+	log.With(kleos.Fields{key: value}).Log("")
+
+	_, fields, _ := strings.Cut(strings.TrimSuffix(out.String(), "\n"), " INF, ")
+	return fields
+}
+
+func TestTextFormat(t *testing.T) {
+	user := textUser{5, "Bob Smith", []string{"admin", "dev"}}
+	count := 7
+	var missing *textUser
+
+	tests := []struct {
+		comment string
+		format  kleos.TextFormat
+		value   interface{}
+		want    string
+	}{
+		{"struct", kleos.TextFormat{}, user, `user="{\"id\":5,\"name\":\"Bob Smith\",\"roles\":[\"admin\",\"dev\"]}"`},
+		{"map", kleos.TextFormat{}, map[string]int{"b": 2, "a": 1}, `user="{\"a\":1,\"b\":2}"`},
+		{"slice", kleos.TextFormat{}, []int{1, 2, 3}, `user=[1,2,3]`},
+		{"no html escaping", kleos.TextFormat{}, []string{"<a>"}, `user="[\"<a>\"]"`},
+		{"pointer", kleos.TextFormat{}, &count, "user=7"},
+		{"nil pointer", kleos.TextFormat{}, missing, "user=<nil>"},
+		{"uint", kleos.TextFormat{}, uint64(18446744073709551615), "user=18446744073709551615"},
+		{"uint8", kleos.TextFormat{}, uint8(8), "user=8"},
+		{"duration", kleos.TextFormat{}, 1500 * time.Millisecond, "user=1.5s"},
+		{"text marshaler", kleos.TextFormat{}, textLevel(3), "user=level-3"},
+		{"json marshaler", kleos.TextFormat{}, textPoint{1, 2}, "user=[1,2]"},
+		{"bytes hex", kleos.TextFormat{}, []byte{0x0a, 0xff}, "user=0aff"},
+		{"bytes base64", kleos.TextFormat{Bytes: kleos.BytesBase64}, []byte{0x0a, 0xff}, `user="Cv8="`},
+		{"flatten struct", kleos.TextFormat{Nested: kleos.NestedFlatten}, user,
+			`user.id=5, user.name="Bob Smith", user.roles.0=admin, user.roles.1=dev`},
+		{"flatten pointer", kleos.TextFormat{Nested: kleos.NestedFlatten}, &user,
+			`user.id=5, user.name="Bob Smith", user.roles.0=admin, user.roles.1=dev`},
+		{"flatten nested map", kleos.TextFormat{Nested: kleos.NestedFlatten},
+			map[string]interface{}{"a": map[string]interface{}{"b": 1.5, "c": nil}, "d": []int{}, "e": map[string]int{}},
+			`user.a.b=1.5, user.a.c=null, user.d=[], user.e={}`},
+		{"flatten json marshaler", kleos.TextFormat{Nested: kleos.NestedFlatten}, textPoint{1, 2}, "user=[1,2]"},
+		{"flatten scalar", kleos.TextFormat{Nested: kleos.NestedFlatten}, 42, "user=42"},
+		{"truncated", kleos.TextFormat{MaxLength: 5}, "Hello World", "user=Hello…"},
+		{"truncated runes", kleos.TextFormat{MaxLength: 3}, "日本語です", "user=日本語…"},
+		{"not truncated", kleos.TextFormat{MaxLength: 5}, "Hello", "user=Hello"},
+		{"truncated json", kleos.TextFormat{MaxLength: 8}, user, `user="{\"id\":5,…"`},
+		{"truncated flattened", kleos.TextFormat{Nested: kleos.NestedFlatten, MaxLength: 3}, user,
+			`user.id=5, user.name=Bob…, user.roles.0=adm…, user.roles.1=dev`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			assert.Equal(t, test.want, logTextFormat(test.format, "user", test.value))
+		})
+	}
+}
+
+func TestTextFormatTypedFields(t *testing.T) {
+	var out bytes.Buffer
+
+	output := kleos.NewColorOutput(&out)
+	output.TextFormat = kleos.TextFormat{Nested: kleos.NestedFlatten, MaxLength: 4}
+
+	log := kleos.New()
+	log.SetOutput(output)
+	log.EnableSource(false)
+
+	log.Add(kleos.Object("user", textUser{ID: 5}), kleos.String("name", "Bob Smith")).Log("")
+
+	line := out.String()
+	assert.Contains(t, line, "user.id")
+	assert.Contains(t, line, "user.roles=null")
+	assert.Contains(t, line, `name="Bob …"`)
+}
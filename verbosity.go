@@ -1,6 +1,16 @@
 package kleos
 
-var verbosity uint8
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidVModule returned when a verbosity override passed to SetVModule can't be parsed.
+var ErrInvalidVModule = errors.New("invalid vmodule pattern")
 
 // SetVerbosity sets the verbosity level of the debug logging.  Zero disable debug logging.
 func SetVerbosity(level uint8) {
@@ -9,10 +19,12 @@ func SetVerbosity(level uint8) {
 
 // SetVerbosity sets the verbosity level of the debug logging.  Zero disable debug logging.
 func (k *Kleos) SetVerbosity(level uint8) {
-	k.Lock()
-	defer k.Unlock()
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
 
-	verbosity = level
+	root.verbosity = level
 }
 
 // Verbosity represents a message's verbosity level, starting at level 0 (lowest detail,
@@ -44,8 +56,196 @@ func Verbosity() uint8 {
 //   - 4 - Relentlessly specific details, such as incoming and outgoing large JSON
 //     documents, full HTTP request body, etc.
 func (k *Kleos) Verbosity() uint8 {
-	k.RLock()
-	defer k.RUnlock()
+	root := k.base()
+
+	root.RLock()
+	defer root.RUnlock()
+
+	return root.verbosity
+}
+
+// SetVModule overrides the verbosity of the global logger for some packages or source files,
+// like glog's -vmodule flag.  See Kleos.SetVModule for details.
+func SetVModule(spec string) error {
+	return local.SetVModule(spec)
+}
+
+// SetVModule overrides the verbosity for debug messages logged from some packages or source
+// files, so debugging one package doesn't flood the log with messages from every other
+// package.  The spec is a comma-separated list of pattern=verbosity pairs, e.g.
+// "billing=3,http/*=2,cache.go=4":
+//
+//   - A pattern ending in ".go" matches a source file name, e.g. "cache.go".
+//   - A pattern with a slash matches the package and file name, e.g. "http/*" or
+//     "http/server.go".
+//   - Any other pattern matches the package name, i.e. the name of the directory holding the
+//     source file, e.g. "billing".
+//
+// Patterns may use the wildcards supported by filepath.Match.  The first matching pattern
+// sets the verbosity of the call site; call sites that don't match use the logger's
+// verbosity.  The verbosity may be lower than the logger's, e.g. "chatty=0" to silence a
+// package.
+//
+// Call sites are matched once and cached, so checking the verbosity stays cheap.  An empty
+// spec removes the overrides.  Returns an error if the spec is invalid, in which case the
+// current overrides are left alone.
+func (k *Kleos) SetVModule(spec string) error {
+	vm, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+
+	root := k.base()
+
+	root.Lock()
+	defer root.Unlock()
+
+	root.vmodule = vm
+
+	return nil
+}
+
+// Returns the highest verbosity a message from any call site might be logged at, taking the
+// overrides from SetVModule into account.
+func (k *Kleos) maxVerbosity() uint8 {
+	root := k.base()
+
+	root.RLock()
+	defer root.RUnlock()
+
+	verbosity := root.verbosity
+	if root.vmodule != nil && root.vmodule.max > verbosity {
+		verbosity = root.vmodule.max
+	}
 
 	return verbosity
 }
+
+// VModule returns the verbosity overrides for the global logger set with SetVModule.
+func VModule() string {
+	return local.VModule()
+}
+
+// VModule returns the verbosity overrides set with SetVModule.
+func (k *Kleos) VModule() string {
+	root := k.base()
+
+	root.RLock()
+	defer root.RUnlock()
+
+	if root.vmodule == nil {
+		return ""
+	}
+
+	return root.vmodule.spec
+}
+
+// The verbosity overrides for packages and source files, with a cache of the verbosity of
+// each call site.
+type vmodule struct {
+	spec     string
+	patterns []vmodulePattern
+	max      uint8 // the highest verbosity of any pattern
+
+	cache sync.Map // uintptr to the verbosity of the call site, or -1 if no pattern matches
+}
+
+type vmodulePattern struct {
+	pattern   string
+	verbosity uint8
+	match     func(pattern, pkg, file string) bool
+}
+
+// Parses a spec such as "billing=3,http/*=2,cache.go=4".
+func parseVModule(spec string) (*vmodule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	vm := &vmodule{spec: spec}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern, value, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVModule, part)
+		}
+
+		verbosity, err := strconv.ParseUint(strings.TrimSpace(value), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVModule, part)
+		}
+
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVModule, part)
+		}
+
+		p := vmodulePattern{
+			pattern:   pattern,
+			verbosity: uint8(verbosity),
+		}
+
+		switch {
+		case strings.Contains(pattern, "/"):
+			p.match = func(pattern, pkg, file string) bool {
+				ok, _ := filepath.Match(pattern, pkg+"/"+file)
+				return ok
+			}
+		case strings.HasSuffix(pattern, ".go"):
+			p.match = func(pattern, _, file string) bool {
+				ok, _ := filepath.Match(pattern, file)
+				return ok
+			}
+		default:
+			p.match = func(pattern, pkg, _ string) bool {
+				ok, _ := filepath.Match(pattern, pkg)
+				return ok
+			}
+		}
+
+		vm.patterns = append(vm.patterns, p)
+
+		if p.verbosity > vm.max {
+			vm.max = p.verbosity
+		}
+	}
+
+	return vm, nil
+}
+
+// Returns the verbosity of the call site, and whether a pattern matched it.
+func (vm *vmodule) verbosity(pc uintptr) (uint8, bool) {
+	if v, ok := vm.cache.Load(pc); ok {
+		return vm.result(v.(int))
+	}
+
+	v := -1
+
+	if pkg, file, _, found := resolveSource(pc); found {
+		for _, p := range vm.patterns {
+			if p.match(p.pattern, pkg, file) {
+				v = int(p.verbosity)
+				break
+			}
+		}
+	}
+
+	vm.cache.Store(pc, v)
+
+	return vm.result(v)
+}
+
+// Converts a cached verbosity to the verbosity and whether a pattern matched.
+func (vm *vmodule) result(v int) (uint8, bool) {
+	if v < 0 {
+		return 0, false
+	}
+
+	return uint8(v), true
+}
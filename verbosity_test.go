@@ -2,6 +2,7 @@ package kleos_test
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 
@@ -42,3 +43,149 @@ func TestVerbosity(t *testing.T) {
 
 	out.Reset()
 }
+
+func TestInstanceVerbosity(t *testing.T) {
+	assert := assert.New(t)
+
+	var quiet, loud bytes.Buffer
+
+	q := kleos.New()
+	q.SetOutput(kleos.NewTextOutput(&quiet))
+	q.SetVerbosity(1)
+
+	l := kleos.New()
+	l.SetOutput(kleos.NewTextOutput(&loud))
+	l.SetVerbosity(3)
+
+	assert.Equal(uint8(1), q.Verbosity())
+	assert.Equal(uint8(3), l.Verbosity())
+
+	q.V(3).Log("Hello World")
+	l.V(3).Log("Hello World")
+
+	assert.Empty(quiet.String())
+	assert.Contains(loud.String(), "D03")
+
+	// Instances shouldn't affect the global logger
+	var out bytes.Buffer
+	kleos.SetOutput(kleos.NewTextOutput(&out))
+	kleos.SetVerbosity(0)
+
+	l.SetVerbosity(4)
+	kleos.V(1).Log("Hello World")
+
+	assert.Empty(out.String())
+	assert.Equal(uint8(0), kleos.Verbosity())
+}
+
+func TestVModule(t *testing.T) {
+	tests := []struct {
+		spec    string
+		global  uint8
+		logged  uint8 // highest verbosity logged
+		comment string
+	}{
+		{"", 1, 1, "no overrides"},
+		{"kleos=3", 0, 3, "package"},
+		{"verbosity_test.go=2", 0, 2, "file"},
+		{"verbosity_*.go=2", 0, 2, "file wildcard"},
+		{"kleos/*=4", 1, 4, "package and file"},
+		{"other=4,kleos/verbosity_test.go=2", 0, 2, "no match on other packages"},
+		{"kleos=1,kleos=4", 0, 1, "first match wins"},
+		{"kleos=0", 4, 0, "lower than the global verbosity"},
+		{"other=4", 1, 1, "falls back on the global verbosity"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.comment, func(t *testing.T) {
+			var out bytes.Buffer
+
+			log := kleos.New()
+			log.SetOutput(kleos.NewTextOutput(&out))
+			log.SetVerbosity(test.global)
+
+			if !assert.NoError(t, log.SetVModule(test.spec)) {
+				return
+			}
+
+			for v := uint8(1); v <= 5; v++ {
+				out.Reset()
+				log.V(v).Log("Hello World")
+
+				if v <= test.logged {
+					assert.NotEmpty(t, out.String(), "verbosity %d", v)
+				} else {
+					assert.Empty(t, out.String(), "verbosity %d", v)
+				}
+			}
+		})
+	}
+}
+
+func TestVModuleAdapter(t *testing.T) {
+	for _, source := range []bool{true, false} {
+		t.Run(fmt.Sprintf("source %v", source), func(t *testing.T) {
+			assert := assert.New(t)
+
+			var out bytes.Buffer
+
+			log := kleos.New()
+			log.SetOutput(kleos.NewTextOutput(&out))
+			log.EnableSource(source)
+
+			// Checked against the code calling the log.Logger, not the log package
+			assert.NoError(log.SetVModule("verbosity_test.go=2"))
+
+			log.StdLogger(2).Print("Hello World")
+			assert.Contains(out.String(), "D02")
+
+			out.Reset()
+			log.StdLogger(3).Print("Hello World")
+			assert.Empty(out.String())
+
+			out.Reset()
+			log.Logger(2).Printf("Hello %s", "World")
+			assert.Contains(out.String(), "D02")
+		})
+	}
+}
+
+func TestVModuleSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+
+	log := kleos.New()
+	log.SetOutput(kleos.NewTextOutput(&out))
+	log.EnableSource(false)
+
+	assert.NoError(log.SetVModule(" kleos = 3 , cache.go=4 "))
+	assert.Equal("kleos = 3 , cache.go=4", log.VModule())
+
+	// Overrides apply even without reporting the source, and to derived loggers
+	log.Named("billing").V(3).Log("Hello World")
+	assert.Contains(out.String(), "D03")
+
+	// Changing the verbosity after the message is generated
+	out.Reset()
+	log.V(5).V(3).Log("Hello World")
+	assert.Contains(out.String(), "D03")
+
+	out.Reset()
+	log.V(3).V(5).Log("Hello World")
+	assert.Empty(out.String())
+
+	for _, spec := range []string{"kleos", "kleos=x", "=3", "kleos=256", "[=3"} {
+		assert.ErrorIs(log.SetVModule(spec), kleos.ErrInvalidVModule, spec)
+	}
+
+	// Invalid specs don't change the overrides
+	assert.Equal("kleos = 3 , cache.go=4", log.VModule())
+
+	assert.NoError(log.SetVModule(""))
+	assert.Empty(log.VModule())
+
+	out.Reset()
+	log.V(3).Log("Hello World")
+	assert.Empty(out.String())
+}